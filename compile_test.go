@@ -0,0 +1,220 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// TestGeneratedCodeCompiles generates the code of the testdata protos with
+// protoc-gen-go, protoc-gen-go-grpc and this plugin, and vets it. Cases with
+// a directory in testdata/behavior also run the tests in it, copied into the
+// generated module, against the generated code.
+func TestGeneratedCodeCompiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the generated code")
+	}
+	bin := t.TempDir()
+	goCommand(t, ".", "build", "-o", bin,
+		"google.golang.org/protobuf/cmd/protoc-gen-go",
+		"google.golang.org/grpc/cmd/protoc-gen-go-grpc")
+
+	// third/nested.proto is mapped to a Go package like the files of a
+	// third-party module.
+	const param = "module=example.com/gen,Mthird/nested.proto=example.com/gen/vendored/thirdparty"
+	files := []string{
+		"wkt/wkt.proto",
+		"third/nested.proto",
+		"xpkg/common/common.proto",
+		"xpkg/svc/svc.proto",
+		"xpkg/svc/other.proto",
+		"shadow/shadow.proto",
+		"deprecated/deprecated.proto",
+	}
+	tests := []struct {
+		name   string
+		param  string
+		noGRPC bool // the plugin generates the interfaces of protoc-gen-go-grpc
+	}{
+		{"default", "", false},
+		{"helpers", "builders=true,factories=true,fuzz_targets=true,enum_aliases=true", false},
+		{"interfaces", "method_interfaces=true,simple_clients=true,test_skeletons=true,examples=true", false},
+		{"single_file", "single_file=true,builders=true,factories=true", false},
+		{"skip_deprecated", "skip_deprecated=true,method_interfaces=true,simple_clients=true", false},
+		{"streams", "share_stream_mocks=true,script_metadata=true", false},
+		{"log_calls", "log_calls=true,retry_helpers=true", false},
+		{"mockery", "framework=mockery", false},
+		{"minimock", "framework=minimock", false},
+		{"framework_overrides", "config=testdata/frameworks.yaml,method_interfaces=true,simple_clients=true", false},
+		{"grpc_mocks", "grpc_mocks=example.com/gen/grpcmock", false},
+		{"generics", "go_version=1.18,grpc_mocks=example.com/gen/grpcmock", false},
+		{"interceptors", "mock_import_prefix=example.com/gen/mocks,interceptor_harness=true,unimplemented_servers=true,grpc_mocks=example.com/gen/grpcmock", false},
+		{"contracts", "mock_import_prefix=example.com/gen/mocks,contracts=true,unimplemented_servers=true", false},
+		{"mock_import_prefix", "mock_import_prefix=example.com/gen/mocks,builders=true,matchers=true,factories=true,fixtures=true,record_sends=true,contracts=true", false},
+		{"interfaces_only", "interfaces_only=true", true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			writeModule(t, dir)
+			type plugin struct{ name, param string }
+			plugins := []plugin{
+				{filepath.Join(bin, "protoc-gen-go"), param},
+				{"", param + "," + tt.param},
+			}
+			if !tt.noGRPC {
+				plugins = append(plugins, plugin{filepath.Join(bin, "protoc-gen-go-grpc"), param})
+			}
+			for _, p := range plugins {
+				resp, _ := runPlugin(t, p.name, compileRequest(t, p.param, files...))
+				writeResponse(t, dir, resp)
+			}
+			checkImports(t, dir)
+			goCommand(t, dir, "vet", "./...")
+			if copyTests(t, filepath.Join("testdata", "behavior", tt.name), dir) {
+				goCommand(t, dir, "test", "./...")
+			}
+		})
+	}
+}
+
+// TestGRPCServiceMocksCompile generates mocks of the services grpc-go
+// declares into a package of their own, and vets them.
+func TestGRPCServiceMocksCompile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the generated code")
+	}
+	dir := t.TempDir()
+	writeModule(t, dir)
+	req := newRequest("module=example.com/gen,mock_import_prefix=example.com/gen/mocks",
+		grpc_health_v1.File_grpc_health_v1_health_proto,
+		grpc_reflection_v1.File_grpc_reflection_v1_reflection_proto,
+		grpc_reflection_v1alpha.File_grpc_reflection_v1alpha_reflection_proto)
+	resp, _ := runPlugin(t, "", req)
+	writeResponse(t, dir, resp)
+	goCommand(t, dir, "vet", "./...")
+}
+
+// writeModule makes dir the module example.com/gen, with the requirements
+// of this module.
+func writeModule(t *testing.T, dir string) {
+	t.Helper()
+	mod, err := os.ReadFile("go.mod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mod = regexp.MustCompile(`(?m)^module .*$`).ReplaceAll(mod, []byte("module example.com/gen"))
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), mod, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := os.ReadFile("go.sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.sum"), sum, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeResponse writes the files of resp to dir.
+func writeResponse(t *testing.T, dir string, resp *pluginpb.CodeGeneratorResponse) {
+	t.Helper()
+	if resp.GetError() != "" {
+		t.Fatal(resp.GetError())
+	}
+	for _, f := range resp.File {
+		name := filepath.Join(dir, filepath.FromSlash(f.GetName()))
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(f.GetContent()), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkImports checks that the Go files in dir import every package once,
+// and the well-known types under their package names.
+func checkImports(t *testing.T, dir string) {
+	t.Helper()
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || !strings.HasSuffix(name, ".go") {
+			return err
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), name, nil, parser.ImportsOnly)
+		if err != nil {
+			return err
+		}
+		seen := make(map[string]bool)
+		for _, imp := range file.Imports {
+			importPath, _ := strconv.Unquote(imp.Path.Value)
+			if seen[importPath] {
+				t.Errorf("%s imports %s more than once", name, importPath)
+			}
+			seen[importPath] = true
+			if strings.HasPrefix(importPath, "google.golang.org/protobuf/types/known/") && imp.Name != nil && imp.Name.Name != path.Base(importPath) {
+				t.Errorf("%s imports %s as %s", name, importPath, imp.Name.Name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// copyTests copies the files below src, if it exists, to dir, and reports
+// whether it did.
+func copyTests(t *testing.T, src, dir string) bool {
+	t.Helper()
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return false
+	}
+	err := filepath.WalkDir(src, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, name)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(rel)), 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, rel), data, 0o644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return true
+}
+
+// goCommand runs the go command with args in dir.
+func goCommand(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOWORK=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go %v: %v\n%s", args, err, out)
+	}
+}
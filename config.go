@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/pluginpb"
+	"gopkg.in/yaml.v3"
+
+	"github.com/sorcererxw/protoc-gen-go-grpc-mock/pkg/grpcmodel"
+)
+
+// givenParam is the plugin parameter as protoc passed it, before environment
+// variables were expanded and the config file was merged into it.
+var givenParam string
+
+// envVar matches a ${VAR} reference to an environment variable.
+var envVar = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces the ${VAR} references in s with the values of the
+// environment variables. Unset variables are an error rather than empty, as
+// an empty path or module is never what was meant.
+func expandEnv(s string) (string, error) {
+	var err error
+	expanded := envVar.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envVar.FindStringSubmatch(ref)[1]
+		v, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return v
+	})
+	return expanded, err
+}
+
+// expandParams expands the environment variables in the parameter values of
+// req, so one buf.gen.yaml works on machines whose paths differ.
+func expandParams(req *pluginpb.CodeGeneratorRequest) error {
+	givenParam = req.GetParameter()
+	if givenParam == "" {
+		return nil
+	}
+	params := strings.Split(givenParam, ",")
+	for i, param := range params {
+		k, v, ok := strings.Cut(param, "=")
+		if !ok {
+			continue
+		}
+		expanded, err := expandEnv(v)
+		if err != nil {
+			return fmt.Errorf("parameter %s: %w", k, err)
+		}
+		params[i] = k + "=" + expanded
+	}
+	req.Parameter = proto.String(strings.Join(params, ","))
+	return nil
+}
+
+// overrides are the per-service overrides of the config file, keyed by the
+// full name of the service.
+var overrides map[string]serviceOverride
+
+// serviceOverride changes how the mocks of a single service are generated.
+type serviceOverride struct {
+	Skip           bool                      `yaml:"skip"`             // generate nothing for the service
+	MockName       string                    `yaml:"mock_name"`        // name of the client mock
+	ServerMockName string                    `yaml:"server_mock_name"` // name of the server mock
+	Framework      string                    `yaml:"framework"`        // mocking library of all mocks of the service
+	Methods        map[string]methodOverride `yaml:"methods"`          // keyed by method name
+}
+
+// methodOverride changes how the mocks of a single method are generated.
+type methodOverride struct {
+	// Skip omits the method and stream interfaces of the method. The client
+	// and server mocks keep it, they could not implement their interfaces
+	// otherwise.
+	Skip bool `yaml:"skip"`
+}
+
+// applyConfig merges the options of the YAML file named by the config
+// parameter into the parameter of req. The file maps option names to their
+// values, with a list for options that can be repeated, and services to their
+// overrides:
+//
+//	framework: gomock
+//	matchers: true
+//	hook: [./hooks/rename.so, ./hooks/tags.so]
+//	services:
+//	  petstore.v1.PetStore:
+//	    mock_name: FakePetStore
+//	    framework: mockery
+//	    methods:
+//	      WatchPets: {skip: true}
+//
+// Options passed as parameters take precedence over the file, and ${VAR} in
+// its values is expanded like in parameters.
+func applyConfig(req *pluginpb.CodeGeneratorRequest) error {
+	path := requestParam(req, "config")
+	if path == "" {
+		return nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed reading config: %w", err)
+	}
+	// Values are decoded as nodes, so that they are passed on as written:
+	// decoded as numbers, go_version 1.20 would become 1.2.
+	var options map[string]yaml.Node
+	if err := yaml.Unmarshal(content, &options); err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+	if services, ok := options["services"]; ok {
+		delete(options, "services")
+		if overrides, err = decodeOverrides(services); err != nil {
+			return fmt.Errorf("config %s: services: %w", path, err)
+		}
+	}
+	params, err := configParams(options)
+	if err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+	if param := req.GetParameter(); param != "" {
+		params = append(params, param)
+	}
+	req.Parameter = proto.String(strings.Join(params, ","))
+	return nil
+}
+
+// protogenParams are the parameters protogen handles itself, besides M.
+var protogenParams = map[string]bool{"module": true, "paths": true, "annotate_code": true}
+
+// configParams returns the parameters setting options, sorted by name.
+func configParams(options map[string]yaml.Node) ([]string, error) {
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var params []string
+	for _, name := range names {
+		if name == "config" || flags.Lookup(name) == nil && !protogenParams[name] && !strings.HasPrefix(name, "M") {
+			return nil, fmt.Errorf("unknown option %q", name)
+		}
+		node := options[name]
+		if node.Kind == yaml.AliasNode {
+			node = *node.Alias
+		}
+		values := []*yaml.Node{&node}
+		if node.Kind == yaml.SequenceNode {
+			values = node.Content
+		}
+		for _, v := range values {
+			if v.Kind == yaml.AliasNode {
+				v = v.Alias
+			}
+			if v.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("option %q: want a scalar or a list of scalars", name)
+			}
+			value := v.Value
+			if v.Tag == "!!null" {
+				value = ""
+			}
+			s, err := expandEnv(value)
+			if err != nil {
+				return nil, fmt.Errorf("option %q: %w", name, err)
+			}
+			if strings.Contains(s, ",") {
+				return nil, fmt.Errorf("option %q: values cannot contain commas", name)
+			}
+			params = append(params, name+"="+s)
+		}
+	}
+	return params, nil
+}
+
+// decodeOverrides decodes the services section of the config file, rejecting
+// settings that cannot be overridden per service.
+func decodeOverrides(services yaml.Node) (map[string]serviceOverride, error) {
+	content, err := yaml.Marshal(&services)
+	if err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	var decoded map[string]serviceOverride
+	if err := dec.Decode(&decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// mockOverride holds what the overrides of a service change for the mock of
+// one of its interfaces.
+type mockOverride struct {
+	name      string // empty for the default name
+	framework string // empty for the framework option
+}
+
+// gomockOptions are the options that only the gomock mocks support, so
+// services cannot override the framework while any of them is set.
+var gomockOptions = []string{
+	"share_stream_mocks", "record_sends", "script_metadata", "retry_helpers",
+	"log_calls", "unimplemented_servers", "test_skeletons", "examples",
+}
+
+// applyOverrides removes the services the overrides skip from files, and
+// returns what they change for the mocks, keyed by the import path of the
+// package the mocks are written to and the interface name, as services of
+// different packages can share their name. It fails for overrides of methods
+// that are not in their service and for unsupported frameworks, and warns
+// about overrides of services that are not in files: with buf's
+// strategy: directory, every invocation sees the overrides of all
+// directories.
+func applyOverrides(files []*protogen.File, diags *diagnostics) (map[protogen.GoImportPath]map[string]mockOverride, error) {
+	found := make(map[string]bool)
+	mocks := make(map[protogen.GoImportPath]map[string]mockOverride)
+	for _, file := range files {
+		pkgMocks := mocks[mockPackageOf(file).importPath]
+		if pkgMocks == nil {
+			pkgMocks = make(map[string]mockOverride)
+			mocks[mockPackageOf(file).importPath] = pkgMocks
+		}
+		kept := file.Services[:0]
+		for _, s := range file.Services {
+			o, ok := overrides[string(s.Desc.FullName())]
+			if !ok {
+				kept = append(kept, s)
+				continue
+			}
+			found[string(s.Desc.FullName())] = true
+			for name := range o.Methods {
+				if s.Desc.Methods().ByName(protoreflect.Name(name)) == nil {
+					return nil, fmt.Errorf("config: service %s has no method %s", s.Desc.FullName(), name)
+				}
+			}
+			if o.Skip {
+				continue
+			}
+			if err := checkFrameworkOverride(s, o.Framework); err != nil {
+				return nil, err
+			}
+			for _, intf := range serviceInterfaceNames(s) {
+				pkgMocks[intf] = mockOverride{framework: o.Framework}
+			}
+			pkgMocks[grpcmodel.ClientInterfaceName(s)] = mockOverride{name: o.MockName, framework: o.Framework}
+			pkgMocks[grpcmodel.ServerInterfaceName(s)] = mockOverride{name: o.ServerMockName, framework: o.Framework}
+			kept = append(kept, s)
+		}
+		file.Services = kept
+	}
+	var missing []string
+	for name := range overrides {
+		if !found[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	for _, name := range missing {
+		diags.warnAt(flags.Lookup("config").Value.String(), "no service %s in the request, its overrides are ignored", name)
+	}
+	return mocks, nil
+}
+
+// checkFrameworkOverride fails if the mocks of s cannot be written for
+// framework, which is empty if the service does not override it.
+func checkFrameworkOverride(s *protogen.Service, framework string) error {
+	if framework == "" {
+		return nil
+	}
+	if _, ok := frameworkTemplates[framework]; !ok {
+		return fmt.Errorf("config: service %s: unknown framework %q, must be gomock, mockery or minimock", s.Desc.FullName(), framework)
+	}
+	if framework == "gomock" {
+		return nil
+	}
+	for _, name := range gomockOptions {
+		if flags.Lookup(name).Value.String() == "true" {
+			return fmt.Errorf("config: service %s: framework %s is not supported with %s", s.Desc.FullName(), framework, name)
+		}
+	}
+	return nil
+}
+
+// serviceInterfaceNames returns the names of all interfaces generated for s.
+func serviceInterfaceNames(s *protogen.Service) []string {
+	names := []string{
+		grpcmodel.ClientInterfaceName(s),
+		grpcmodel.ServerInterfaceName(s),
+		grpcmodel.SimpleClientInterfaceName(s),
+	}
+	for _, m := range s.Methods {
+		names = append(names, grpcmodel.MethodInterfaceName(m))
+		if grpcmodel.MethodTypeOf(m) != grpcmodel.MethodTypeUnary {
+			names = append(names, grpcmodel.StreamClientInterfaceName(m), grpcmodel.StreamServerInterfaceName(m))
+		}
+	}
+	return names
+}
+
+// profiles are the options the profile parameter turns on. Every profile
+// includes the ones before it.
+var profiles = map[string][]string{
+	"minimal":  nil,
+	"standard": {"matchers", "builders", "contracts"},
+	"full":     {"matchers", "builders", "contracts", "factories", "fixtures", "enum_aliases"},
+}
+
+// gomockProfile are the options the full profile turns on only with
+// framework=gomock, as the other frameworks do not support them.
+var gomockProfile = []string{"record_sends", "script_metadata", "retry_helpers", "log_calls"}
+
+// testOnlyOptions are the options generating helpers that import packages
+// meant for tests only. They require mock_import_prefix, so that the Go
+// packages of the protos do not import those, and the profiles turn them on
+// only along with it.
+var testOnlyOptions = []struct {
+	name    string
+	imports string // what the helpers import
+}{
+	{"fixtures", "testing"},
+	{"matchers", "go-cmp and protocmp"},
+	{"record_sends", "testing, go-cmp and protocmp"},
+	{"contracts", "testing"},
+}
+
+// isTestOnly reports whether option is one of testOnlyOptions.
+func isTestOnly(option string) bool {
+	for _, o := range testOnlyOptions {
+		if o.name == option {
+			return true
+		}
+	}
+	return false
+}
+
+// profileDropped are the options of the profile that applyProfile left out
+// as they require mock_import_prefix, and were not set otherwise.
+var profileDropped []string
+
+// applyProfile prepends the options of the profile named by the profile
+// parameter, or the config file, to the parameter of req, so any of them can
+// be turned off again.
+func applyProfile(req *pluginpb.CodeGeneratorRequest) error {
+	name := requestParam(req, "profile")
+	if name == "" {
+		return nil
+	}
+	options, ok := profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %q, must be minimal, standard or full", name)
+	}
+	if fw := requestParam(req, "framework"); name == "full" && (fw == "" || fw == "gomock") {
+		options = append(options, gomockProfile...)
+	}
+	params := make([]string, 0, len(options)+1)
+	for _, option := range options {
+		if requestParam(req, "mock_import_prefix") == "" && isTestOnly(option) {
+			if requestParam(req, option) == "" {
+				profileDropped = append(profileDropped, option)
+			}
+			continue
+		}
+		params = append(params, option+"=true")
+	}
+	req.Parameter = proto.String(strings.Join(append(params, req.GetParameter()), ","))
+	return nil
+}
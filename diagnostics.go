@@ -0,0 +1,316 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/sorcererxw/protoc-gen-go-grpc-mock/pkg/grpcmodel"
+)
+
+type severity int
+
+const (
+	severityWarning severity = iota
+	severityError
+)
+
+func (s severity) String() string {
+	if s == severityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// diagnostic is a problem found while generating mocks, located at the proto
+// element it was found for.
+type diagnostic struct {
+	severity severity
+	location string // file:line:column when source info is available
+	element  string // full name of the service or method, may be empty
+	message  string
+}
+
+func (d diagnostic) String() string {
+	var b strings.Builder
+	b.WriteString(d.location)
+	b.WriteString(": ")
+	if d.element != "" {
+		b.WriteString(d.element)
+		b.WriteString(": ")
+	}
+	b.WriteString(d.severity.String())
+	b.WriteString(": ")
+	b.WriteString(d.message)
+	return b.String()
+}
+
+// diagnostics collects problems across all files of a request, so that a
+// single run reports every one of them instead of stopping at the first.
+type diagnostics struct {
+	list []diagnostic
+}
+
+func (d *diagnostics) add(sev severity, desc protoreflect.Descriptor, format string, args ...interface{}) {
+	diag := diagnostic{
+		severity: sev,
+		location: descriptorLocation(desc),
+		message:  fmt.Sprintf(format, args...),
+	}
+	if _, isFile := desc.(protoreflect.FileDescriptor); !isFile {
+		diag.element = string(desc.FullName())
+	}
+	d.list = append(d.list, diag)
+}
+
+func (d *diagnostics) errorf(desc protoreflect.Descriptor, format string, args ...interface{}) {
+	d.add(severityError, desc, format, args...)
+}
+
+func (d *diagnostics) warnf(desc protoreflect.Descriptor, format string, args ...interface{}) {
+	d.add(severityWarning, desc, format, args...)
+}
+
+// warnAt adds a warning about an option rather than a proto element, located
+// at location, such as the path of the config file.
+func (d *diagnostics) warnAt(location, format string, args ...interface{}) {
+	d.list = append(d.list, diagnostic{
+		severity: severityWarning,
+		location: location,
+		message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// writeWarnings writes all warnings to w, which protoc and buf pass through
+// to the user.
+func (d *diagnostics) writeWarnings(w io.Writer) {
+	for _, diag := range d.list {
+		if diag.severity == severityWarning {
+			fmt.Fprintf(w, "protoc-gen-go-grpc-mock: %s\n", diag)
+		}
+	}
+}
+
+// err joins all errors into one, or returns nil if there were none.
+func (d *diagnostics) err() error {
+	var msgs []string
+	for _, diag := range d.list {
+		if diag.severity == severityError {
+			msgs = append(msgs, diag.String())
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(msgs, "\n"))
+}
+
+func descriptorLocation(desc protoreflect.Descriptor) string {
+	file := desc.ParentFile()
+	if file == nil {
+		return string(desc.FullName())
+	}
+	loc := file.SourceLocations().ByDescriptor(desc)
+	if loc.Path == nil {
+		return file.Path()
+	}
+	return fmt.Sprintf("%s:%d:%d", file.Path(), loc.StartLine+1, loc.StartColumn+1)
+}
+
+// checkFile reports problems that would make the mocks generated for file
+// fail to compile or behave unexpectedly. declared holds the Go identifiers
+// protoc-gen-go declares in every Go package of the request. mocks names the
+// mocks and is nil when only the interfaces are generated, and helpers are
+// the identifiers generated next to the mocks, see helperNames.
+func checkFile(diags *diagnostics, file *protogen.File, pkg *grpcmodel.Package, declared map[protogen.GoImportPath]map[string]protoreflect.Descriptor, mocks *generator, helpers []helperName) {
+	names := declared[mockPackageOf(file).importPath]
+	for _, s := range file.Services {
+		if len(s.Methods) == 0 {
+			diags.warnf(s.Desc, "service has no methods, its mocks will be empty")
+		}
+		if mocks != nil {
+			checkMethodNames(diags, s, mocks.framework(grpcmodel.ClientInterfaceName(s)))
+		}
+	}
+
+	seen := make(map[string]bool, len(pkg.Interfaces))
+	for _, intf := range pkg.Interfaces {
+		if seen[intf.Name] {
+			diags.errorf(file.Desc, "interface %s is generated more than once", intf.Name)
+		}
+		seen[intf.Name] = true
+
+		generated := []string{intf.Name}
+		if mocks != nil {
+			mock := mocks.mockName(intf.Name)
+			generated = []string{mock, mock + "MockRecorder", "New" + mock}
+		}
+		for _, name := range generated {
+			if desc, ok := names[name]; ok {
+				diags.errorf(desc, "Go name %s collides with the code generated for %s in %s", name, intf.Name, file.Desc.Path())
+			}
+		}
+	}
+	for _, h := range helpers {
+		if desc, ok := names[h.name]; ok {
+			diags.errorf(desc, "Go name %s collides with the code generated for %s in %s", h.name, h.owner.FullName(), file.Desc.Path())
+		}
+	}
+}
+
+// helperName is a Go identifier generated next to the mocks for a message or
+// service, besides the mocks themselves.
+type helperName struct {
+	name  string
+	owner protoreflect.Descriptor
+}
+
+// helperNames returns the identifiers of the helpers generated for file with
+// the options of opts, in the order they are generated.
+func helperNames(file *protogen.File, opts fileOptions) []helperName {
+	var names []helperName
+	add := func(owner protoreflect.Descriptor, idents ...string) {
+		for _, name := range idents {
+			names = append(names, helperName{name, owner})
+		}
+	}
+	elements := sourceElements(file)
+	for _, s := range file.Services {
+		deprecated := *skipDeprecated && elements[grpcmodel.ClientInterfaceName(s)].deprecated
+		server := grpcmodel.ServerInterfaceName(s)
+		if *contracts && !deprecated {
+			add(s.Desc, s.GoName+"Contracts")
+		}
+		if *harnesses && !deprecated {
+			for _, m := range s.Methods {
+				add(m.Desc, "Intercept"+s.GoName+"_"+m.GoName)
+			}
+		}
+		if *unimplServers {
+			add(s.Desc, "Partial"+server)
+		}
+		if *fuzzTargets && !deprecated {
+			for _, m := range s.Methods {
+				if grpcmodel.MethodTypeOf(m) != grpcmodel.MethodTypeUnary {
+					continue
+				}
+				add(m.Desc, "Fuzz"+server+"_"+m.GoName)
+			}
+		}
+	}
+	for _, msg := range ownedMessages(file, opts.builderOwners, false) {
+		add(msg.Desc, msg.GoIdent.GoName+"Builder", "New"+msg.GoIdent.GoName+"Builder")
+	}
+	for _, msg := range ownedMessages(file, opts.fixtureOwners, false) {
+		add(msg.Desc, "Load"+msg.GoIdent.GoName, "SaveGolden"+msg.GoIdent.GoName)
+	}
+	for _, msg := range ownedMessages(file, opts.matcherOwners, false) {
+		add(msg.Desc, msg.GoIdent.GoName+"Matcher", "Match"+msg.GoIdent.GoName, "Eq"+msg.GoIdent.GoName+"Ignoring")
+	}
+	for _, msg := range ownedMessages(file, opts.factoryOwners, true) {
+		add(msg.Desc, "Fake"+msg.GoIdent.GoName)
+	}
+	return names
+}
+
+// checkSetterNames reports fields of msgs whose builder, or matcher, method
+// is named like the one of another field of the same message: the
+// With<Field> setters of all fields, the With<Field>Entry methods of map
+// fields and, on matchers, the With<Field>Set methods of oneof fields.
+func checkSetterNames(diags *diagnostics, msgs []*protogen.Message, matcher bool) {
+	helper := "Builder"
+	if matcher {
+		helper = "Matcher"
+	}
+	for _, msg := range msgs {
+		fields := make(map[string]*protogen.Field)
+		add := func(method string, field *protogen.Field) {
+			if other, ok := fields[method]; ok {
+				diags.errorf(field.Desc, "method %s of %s%s collides with the one generated for field %s", method, msg.GoIdent.GoName, helper, other.Desc.Name())
+				return
+			}
+			fields[method] = field
+		}
+		for _, field := range msg.Fields {
+			add("With"+field.GoName, field)
+		}
+		for _, field := range msg.Fields {
+			if field.Desc.IsMap() {
+				add("With"+field.GoName+"Entry", field)
+			}
+		}
+		if !matcher {
+			continue
+		}
+		for _, oneof := range msg.Oneofs {
+			if oneof.Desc.IsSynthetic() {
+				continue
+			}
+			for _, field := range oneof.Fields {
+				add("With"+field.GoName+"Set", field)
+			}
+		}
+	}
+}
+
+// checkMethodNames reports methods of s whose names collide with members
+// the mocks of framework declare and cannot rename. The gomock mock renames
+// its own members instead, see mockData.Member.
+func checkMethodNames(diags *diagnostics, s *protogen.Service, framework string) {
+	names := make(map[string]bool, len(s.Methods))
+	for _, m := range s.Methods {
+		names[m.GoName] = true
+	}
+	for _, m := range s.Methods {
+		switch framework {
+		case "mockery":
+			if m.GoName == "Mock" {
+				diags.errorf(m.Desc, "method name Mock collides with the mock.Mock embedded in the generated mock")
+			}
+		case "minimock":
+			switch {
+			case m.GoName == "MinimockFinish" || m.GoName == "MinimockWait":
+				diags.errorf(m.Desc, "method name %s collides with the %s method of the generated mock", m.GoName, m.GoName)
+			case strings.HasSuffix(m.GoName, "Mock") && names[strings.TrimSuffix(m.GoName, "Mock")]:
+				diags.errorf(m.Desc, "method name %s collides with the expectations field of %s in the generated mock", m.GoName, strings.TrimSuffix(m.GoName, "Mock"))
+			}
+		}
+	}
+}
+
+// declaredGoNames returns the Go identifiers of all messages, enums and enum
+// values in the request, grouped by Go package.
+func declaredGoNames(files []*protogen.File) map[protogen.GoImportPath]map[string]protoreflect.Descriptor {
+	declared := make(map[protogen.GoImportPath]map[string]protoreflect.Descriptor)
+	for _, f := range files {
+		names := declared[f.GoImportPath]
+		if names == nil {
+			names = make(map[string]protoreflect.Descriptor)
+			declared[f.GoImportPath] = names
+		}
+		var addEnums func([]*protogen.Enum)
+		addEnums = func(enums []*protogen.Enum) {
+			for _, e := range enums {
+				names[e.GoIdent.GoName] = e.Desc
+				for _, v := range e.Values {
+					names[v.GoIdent.GoName] = v.Desc
+				}
+			}
+		}
+		var addMessages func([]*protogen.Message)
+		addMessages = func(msgs []*protogen.Message) {
+			for _, m := range msgs {
+				names[m.GoIdent.GoName] = m.Desc
+				addEnums(m.Enums)
+				addMessages(m.Messages)
+			}
+		}
+		addEnums(f.Enums)
+		addMessages(f.Messages)
+	}
+	return declared
+}
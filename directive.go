@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+// mockPackages groups the files of units that have services by the package
+// their mocks are written to, in request order.
+func mockPackages(units [][]*protogen.File) [][]*protogen.File {
+	var packages [][]*protogen.File
+	byPackage := make(map[protogen.GoImportPath]int)
+	for _, files := range units {
+		for _, file := range files {
+			if len(file.Services) == 0 {
+				continue
+			}
+			mp := mockPackageOf(file).importPath
+			if i, ok := byPackage[mp]; ok {
+				packages[i] = append(packages[i], file)
+				continue
+			}
+			byPackage[mp] = len(packages)
+			packages = append(packages, []*protogen.File{file})
+		}
+	}
+	return packages
+}
+
+// generateDirective generates generate.go, holding the go:generate directive
+// regenerating the mocks of the package of out, with the plugin parameter
+// param.
+func generateDirective(out *fileOutput, opts fileOptions, param string) error {
+	mp := mockPackageOf(out.files[0])
+	name := path.Join(mp.dir, "generate.go")
+	g := opts.newGenerator(name, mp.importPath)
+	if err := g.generateHeader(string(mp.name)); err != nil {
+		return err
+	}
+	g.p("//go:generate %s", goGenerateCommand(out.files, mp.dir, param))
+	src, err := g.gf.Content()
+	if err != nil {
+		return err
+	}
+	if src, err = g.format(src); err != nil {
+		return err
+	}
+	out.write(name, src, "go:generate directive", nil)
+	return nil
+}
+
+// goGenerateCommand returns the protoc or buf command regenerating the mocks
+// of files, run in the package directory dir. It assumes the directory the
+// output paths are relative to is also the root of the proto import paths,
+// as it is with paths=source_relative and with buf.
+func goGenerateCommand(files []*protogen.File, dir, param string) string {
+	if module := moduleParam(param); module != "" {
+		// protoc strips the module prefix from the written paths.
+		switch {
+		case dir == module:
+			dir = "."
+		case strings.HasPrefix(dir, module+"/"):
+			dir = dir[len(module)+1:]
+		}
+	}
+	root := "."
+	if dir != "." {
+		root = strings.TrimSuffix(strings.Repeat("../", strings.Count(dir, "/")+1), "/")
+	}
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.Desc.Path())
+	}
+	if *goGenerate == "buf" {
+		return fmt.Sprintf("sh -c \"cd %s && buf generate --path %s\"", root, strings.Join(paths, " --path "))
+	}
+	for i, p := range paths {
+		paths[i] = path.Join(root, p)
+	}
+	return fmt.Sprintf("protoc -I %s --go-grpc-mock_out=%s --go-grpc-mock_opt=%s %s", root, root, param, strings.Join(paths, " "))
+}
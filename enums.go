@@ -0,0 +1,107 @@
+package main
+
+import (
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// enumAliases picks the enums aliased next to the mocks of units: those the
+// methods use, directly or through message fields, that are declared in
+// another Go package than the mocks. Every enum is assigned to the first file
+// using it among those whose mocks are written to the same package, so it is
+// aliased exactly once. Enums whose name or value names are already declared
+// in that package, or taken by an enum picked before, are left out.
+func enumAliases(units [][]*protogen.File, declared map[protogen.GoImportPath]map[string]protoreflect.Descriptor) map[*protogen.File][]*protogen.Enum {
+	aliases := make(map[*protogen.File][]*protogen.Enum)
+	taken := make(map[protogen.GoImportPath]map[string]bool)
+	for _, files := range units {
+		for _, file := range files {
+			mp := mockPackageOf(file)
+			names := taken[mp.importPath]
+			if names == nil {
+				names = make(map[string]bool)
+				for name := range declared[mp.importPath] {
+					names[name] = true
+				}
+				taken[mp.importPath] = names
+			}
+		next:
+			for _, enum := range usedEnums(file) {
+				if enum.GoIdent.GoImportPath == mp.importPath || names[enum.GoIdent.GoName] {
+					continue
+				}
+				for _, v := range enum.Values {
+					if names[v.GoIdent.GoName] {
+						continue next
+					}
+				}
+				names[enum.GoIdent.GoName] = true
+				for _, v := range enum.Values {
+					names[v.GoIdent.GoName] = true
+				}
+				aliases[file] = append(aliases[file], enum)
+			}
+		}
+	}
+	return aliases
+}
+
+// usedEnums returns the enums the methods of file use in their input and
+// output messages, and the messages reachable from those through message
+// fields, in the order they are used.
+func usedEnums(file *protogen.File) []*protogen.Enum {
+	var enums []*protogen.Enum
+	seenEnums := make(map[protogen.GoIdent]bool)
+	seen := make(map[protogen.GoIdent]bool)
+	var visit func(*protogen.Message)
+	visit = func(msg *protogen.Message) {
+		if seen[msg.GoIdent] {
+			return
+		}
+		seen[msg.GoIdent] = true
+		for _, field := range msg.Fields {
+			switch {
+			case field.Enum != nil && !seenEnums[field.Enum.GoIdent]:
+				seenEnums[field.Enum.GoIdent] = true
+				enums = append(enums, field.Enum)
+			case field.Message != nil:
+				visit(field.Message)
+			}
+		}
+	}
+	for _, s := range file.Services {
+		for _, m := range s.Methods {
+			visit(m.Input)
+			visit(m.Output)
+		}
+	}
+	return enums
+}
+
+// enumData is the data the "enum" template is executed with.
+type enumData struct {
+	Name   string // alias name
+	Enum   string // enum type
+	Values []enumValue
+}
+
+// enumValue is a constant aliasing an enum value.
+type enumValue struct {
+	Name  string
+	Value string // value qualified by its package
+}
+
+// enumData prepares the aliases of enum and its values.
+func (g *generator) enumData(enum *protogen.Enum) *enumData {
+	d := &enumData{
+		Name: enum.GoIdent.GoName,
+		Enum: g.gf.QualifiedGoIdent(enum.GoIdent),
+	}
+	for _, v := range enum.Values {
+		d.Values = append(d.Values, enumValue{
+			Name:  v.GoIdent.GoName,
+			Value: g.gf.QualifiedGoIdent(v.GoIdent),
+		})
+	}
+	return d
+}
@@ -1,4 +1,7 @@
 // Code generated by protoc-gen-go-grpc-mock. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc-mock (devel)
+// - protoc                  (unknown)
 // source: petstore.proto
 
 package petstore
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/sorcererxw/protoc-gen-go-grpc-mock/pkg/grpcmodel"
+)
+
+const (
+	fmtPackage       = protogen.GoImportPath("fmt")
+	randPackage      = protogen.GoImportPath("math/rand")
+	timePackage      = protogen.GoImportPath("time")
+	timestampPackage = protogen.GoImportPath("google.golang.org/protobuf/types/known/timestamppb")
+	durationPackage  = protogen.GoImportPath("google.golang.org/protobuf/types/known/durationpb")
+)
+
+// fakeNames are the values of string fields that hold a name.
+var fakeNames = []string{"Alice", "Bob", "Carol", "Dave", "Erin", "Frank"}
+
+// factoryData is the data the "factory" template is executed with.
+type factoryData struct {
+	Name       string   // message name, the factory is Fake<Name>
+	Message    string   // message type
+	Rand       string   // *rand.Rand type
+	Statements []string // statements setting the fields of m from r
+}
+
+// factoryData prepares the factory of msg.
+func (g *generator) factoryData(msg *protogen.Message) *factoryData {
+	d := &factoryData{
+		Name:    msg.GoIdent.GoName,
+		Message: g.gf.QualifiedGoIdent(msg.GoIdent),
+		Rand:    "*" + g.gf.QualifiedGoIdent(randPackage.Ident("Rand")),
+	}
+	for _, oneof := range msg.Oneofs {
+		if oneof.Desc.IsSynthetic() {
+			continue
+		}
+		var cases []string
+		for i, field := range oneof.Fields {
+			value, ok := g.fakeValue(field, msg)
+			if !ok {
+				continue
+			}
+			cases = append(cases, fmt.Sprintf("case %d:\nm.%s = &%s{%s: %s}", i, oneof.GoName, g.gf.QualifiedGoIdent(field.GoIdent), field.GoName, value))
+		}
+		if len(cases) > 0 {
+			d.Statements = append(d.Statements, fmt.Sprintf("switch r.Intn(%d) {\n%s\n}", len(oneof.Fields), strings.Join(cases, "\n")))
+		}
+	}
+	for _, field := range msg.Fields {
+		if field.Oneof != nil && !field.Oneof.Desc.IsSynthetic() {
+			continue
+		}
+		if field.Desc.IsMap() {
+			key, _ := g.fakeValue(field.Message.Fields[0], msg)
+			value, ok := g.fakeValue(field.Message.Fields[1], msg)
+			if !ok {
+				continue
+			}
+			goType, _ := fieldGoType(g.gf, field)
+			d.Statements = append(d.Statements, fmt.Sprintf("m.%s = make(%s)\nfor i, n := 0, 1+r.Intn(3); i < n; i++ {\nm.%s[%s] = %s\n}", field.GoName, goType, field.GoName, key, value))
+			continue
+		}
+		value, ok := g.fakeValue(field, msg)
+		if !ok {
+			continue
+		}
+		goType, pointer := fieldGoType(g.gf, field)
+		switch {
+		case field.Desc.IsList():
+			d.Statements = append(d.Statements, fmt.Sprintf("for i, n := 0, 1+r.Intn(3); i < n; i++ {\nm.%s = append(m.%s, %s)\n}", field.GoName, field.GoName, value))
+		case pointer:
+			d.Statements = append(d.Statements, fmt.Sprintf("m.%s = new(%s)\n*m.%s = %s", field.GoName, goType, field.GoName, value))
+		default:
+			d.Statements = append(d.Statements, fmt.Sprintf("m.%s = %s", field.GoName, value))
+		}
+	}
+	return d
+}
+
+// checkFactories warns about the factories of msgs making messages that
+// fail proto.Marshal, because they leave a required field unset: either of a
+// message of another package, which they fill with an empty message, or of
+// a message field they leave unset to not recurse.
+func checkFactories(diags *diagnostics, msgs []*protogen.Message, owners map[protogen.GoIdent]*protogen.File) {
+	for _, owner := range msgs {
+		for _, field := range owner.Fields {
+			msg := field.Message
+			if msg != nil && msg.Desc.IsMapEntry() {
+				msg = msg.Fields[1].Message
+			}
+			if msg == nil {
+				continue
+			}
+			switch msg.Desc.FullName() {
+			case "google.protobuf.Timestamp", "google.protobuf.Duration":
+				continue
+			}
+			if owners[msg.GoIdent] == nil {
+				if req := requiredField(msg); req != nil {
+					diags.warnf(field.Desc, "Fake%s fills it with an empty %s, whose required field %s is unset, so proto.Marshal fails on its messages",
+						owner.GoIdent.GoName, msg.Desc.FullName(), req.Desc.Name())
+				}
+				continue
+			}
+			if field.Desc.Cardinality() == protoreflect.Required && reaches(msg, owner, make(map[protogen.GoIdent]bool)) {
+				diags.warnf(field.Desc, "Fake%s leaves the required field unset to not recurse, so proto.Marshal fails on its messages", owner.GoIdent.GoName)
+			}
+		}
+	}
+}
+
+// requiredField returns the first required field of msg, or nil if it has
+// none.
+func requiredField(msg *protogen.Message) *protogen.Field {
+	for _, field := range msg.Fields {
+		if field.Desc.Cardinality() == protoreflect.Required {
+			return field
+		}
+	}
+	return nil
+}
+
+// fuzzData is the data the "fuzz" template is executed with.
+type fuzzData struct {
+	Server  string // server interface
+	New     string // variable holding the constructor of the fuzzed server
+	Methods []fuzzMethod
+}
+
+// fuzzMethod is the fuzz target of a unary method.
+type fuzzMethod struct {
+	Name   string // fuzz target, Fuzz<Server>_<Method>
+	Method string
+	Input  string // request message name, requests are made by Fake<Input>
+}
+
+// fuzzData prepares the fuzz targets of s, for the unary methods whose
+// request message has a factory in the package of the mocks.
+func (g *generator) fuzzData(s *protogen.Service) *fuzzData {
+	server := grpcmodel.ServerInterfaceName(s)
+	d := &fuzzData{Server: g.sourceType(server), New: "newFuzzed" + server}
+	for _, m := range s.Methods {
+		if grpcmodel.MethodTypeOf(m) != grpcmodel.MethodTypeUnary ||
+			g.factoryOwners[m.Input.GoIdent] == nil || m.Input.GoIdent.GoImportPath != g.source {
+			continue
+		}
+		d.Methods = append(d.Methods, fuzzMethod{
+			Name:   "Fuzz" + server + "_" + m.GoName,
+			Method: m.GoName,
+			Input:  m.Input.GoIdent.GoName,
+		})
+	}
+	return d
+}
+
+// fakeValue returns an expression drawing a single value of field from r.
+// Message fields are filled by the factory of their message when it has one,
+// and it reports false for those that would recurse into owner that way.
+func (g *generator) fakeValue(field *protogen.Field, owner *protogen.Message) (string, bool) {
+	sprintf := g.gf.QualifiedGoIdent(fmtPackage.Ident("Sprintf"))
+	name := string(field.Desc.Name())
+	switch field.Desc.Kind() {
+	case protoreflect.BoolKind:
+		return "r.Intn(2) == 1", true
+	case protoreflect.EnumKind:
+		values := make([]string, 0, len(field.Enum.Values))
+		for _, v := range field.Enum.Values {
+			if v.Desc.Number() != 0 {
+				values = append(values, g.gf.QualifiedGoIdent(v.GoIdent))
+			}
+		}
+		if len(values) == 0 {
+			return g.gf.QualifiedGoIdent(field.Enum.Values[0].GoIdent), true
+		}
+		return fmt.Sprintf("[]%s{%s}[r.Intn(%d)]", g.gf.QualifiedGoIdent(field.Enum.GoIdent), strings.Join(values, ", "), len(values)), true
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return "r.Int31n(1000)", true
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return "uint32(r.Int31n(1000))", true
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return "r.Int63n(1000000)", true
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return "uint64(r.Int63n(1000000))", true
+	case protoreflect.FloatKind:
+		return "r.Float32() * 100", true
+	case protoreflect.DoubleKind:
+		return "r.Float64() * 100", true
+	case protoreflect.StringKind:
+		return fakeString(sprintf, name), true
+	case protoreflect.BytesKind:
+		return fmt.Sprintf("[]byte(%s)", fakeString(sprintf, name)), true
+	}
+
+	msg := field.Message
+	switch msg.Desc.FullName() {
+	case "google.protobuf.Timestamp":
+		return fmt.Sprintf("%s(%s(1600000000+r.Int63n(100000000), 0))",
+			g.gf.QualifiedGoIdent(timestampPackage.Ident("New")), g.gf.QualifiedGoIdent(timePackage.Ident("Unix"))), true
+	case "google.protobuf.Duration":
+		return fmt.Sprintf("%s(%s(r.Int63n(3600)) * %s)",
+			g.gf.QualifiedGoIdent(durationPackage.Ident("New")), g.gf.QualifiedGoIdent(timePackage.Ident("Duration")), g.gf.QualifiedGoIdent(timePackage.Ident("Second"))), true
+	}
+	if g.factoryOwners[msg.GoIdent] == nil {
+		return "&" + g.gf.QualifiedGoIdent(msg.GoIdent) + "{}", true
+	}
+	if reaches(msg, owner, make(map[protogen.GoIdent]bool)) {
+		return "", false
+	}
+	return "Fake" + msg.GoIdent.GoName + "(r)", true
+}
+
+// fakeString returns an expression drawing a string for the field name
+// from r, shaped after what the name suggests the field holds.
+func fakeString(sprintf, name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.Contains(lower, "email"):
+		return sprintf + `("user%d@example.com", r.Intn(10000))`
+	case strings.Contains(lower, "url") || strings.Contains(lower, "uri"):
+		return sprintf + `("https://example.com/%d", r.Intn(10000))`
+	case strings.Contains(lower, "phone"):
+		return sprintf + `("+1555%07d", r.Intn(10000000))`
+	case strings.Contains(lower, "name"):
+		return fmt.Sprintf("%#v[r.Intn(%d)]", fakeNames, len(fakeNames))
+	default:
+		return fmt.Sprintf("%s(%q, r.Intn(10000))", sprintf, name+"-%d")
+	}
+}
+
+// reaches reports whether target can be reached from msg through message
+// fields, including msg being target itself.
+func reaches(msg, target *protogen.Message, seen map[protogen.GoIdent]bool) bool {
+	if msg.GoIdent == target.GoIdent {
+		return true
+	}
+	if seen[msg.GoIdent] {
+		return false
+	}
+	seen[msg.GoIdent] = true
+	for _, field := range msg.Fields {
+		if field.Message != nil && reaches(field.Message, target, seen) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,1117 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	toolsimports "golang.org/x/tools/imports"
+	"google.golang.org/protobuf/compiler/protogen"
+	gofumpt "mvdan.cc/gofumpt/format"
+
+	"github.com/sorcererxw/protoc-gen-go-grpc-mock/pkg/grpcmodel"
+)
+
+const (
+	gomockPackage   = protogen.GoImportPath("go.uber.org/mock/gomock")
+	reflectPackage  = protogen.GoImportPath("reflect")
+	testifyPackage  = protogen.GoImportPath("github.com/stretchr/testify/mock")
+	minimockPackage = protogen.GoImportPath("github.com/gojuno/minimock") // see rewriteImport
+)
+
+// rewriteImport maps the import paths the generated files are written with
+// to the ones they import. protogen names packages after the last element of
+// their import path, so minimock is written without its major version, to be
+// imported as minimock rather than v3.
+func rewriteImport(importPath protogen.GoImportPath) protogen.GoImportPath {
+	if importPath == minimockPackage {
+		return minimockPackage + "/v3"
+	}
+	return importPath
+}
+
+// Shared mocks of grpc.ClientStream and grpc.ServerStream, which the stream
+// mocks embed with share_stream_mocks instead of mocking the methods
+// themselves.
+const (
+	baseClientStreamMock = "mockBaseClientStream"
+	baseServerStreamMock = "mockBaseServerStream"
+)
+
+// frameworkTemplates maps the supported mocking libraries to the template
+// rendering a mock for them.
+var frameworkTemplates = map[string]string{
+	"gomock":   "mock",
+	"mockery":  "mockery",
+	"minimock": "minimock",
+}
+
+// generator renders the mocks of one proto file into a protogen.GeneratedFile,
+// which resolves and imports every package a rendered type refers to.
+type generator struct {
+	gf               *protogen.GeneratedFile
+	overrides        map[string]mockOverride // set by the config file, keyed by interface name, may be empty
+	comments         map[string]string       // may be empty
+	deprecated       map[string]bool         // interfaces and methods of deprecated services and methods, keyed like comments
+	filename         string                  // may be empty
+	copyrightHeader  string
+	buildConstraints string      // may be empty
+	versions         [][2]string // may be empty; tool name and version pairs
+	gofumpt          bool
+	goMinor          int  // Go 1.x language version of the output
+	useAny           bool // emit any instead of interface{}
+
+	templates *template.Template
+
+	// source is the package of the mocked interfaces, which differs from
+	// the package of the file with mock_import_prefix.
+	source protogen.GoImportPath
+
+	ifacesOnly bool // render interface declarations instead of mocks
+	logCalls   bool // generate LogCalls on mocks
+
+	// derived holds the interfaces derived from client interfaces, which
+	// protoc-gen-go-grpc does not declare, keyed by name.
+	derived map[string]derivedInterface
+
+	// streamBases maps stream interfaces to the shared stream mock their
+	// mocks embed, may be empty.
+	streamBases map[string]string
+
+	// sent maps the server stream interfaces whose mocks record the messages
+	// passed to Send to the type of those messages, may be empty.
+	sent map[string]protogen.GoIdent
+
+	// scripted holds the client stream interfaces whose mocks get setters
+	// scripting the metadata Header and Trailer return, may be empty.
+	scripted map[string]bool
+
+	// retried holds the client and server interfaces whose mocks get
+	// FailsThenSucceeds helpers, may be empty.
+	retried map[string]bool
+
+	contracts []*protogen.Service // services to generate contract test suites for, may be empty
+
+	harnesses []*protogen.Service // services to generate interceptor harnesses for, may be empty
+
+	// unimplemented holds the services whose server mocks embed
+	// Unimplemented<Service>Server and get a Partial<Service>Server helper,
+	// may be empty.
+	unimplemented []*protogen.Service
+
+	builders []*protogen.Message // messages to generate builders for, may be empty
+	fixtures []*protogen.Message // messages to generate golden file helpers for, may be empty
+	matchers []*protogen.Message // messages to generate matchers for, may be empty
+
+	// factories holds the messages to generate factories for, may be empty.
+	// factoryOwners holds every message with a factory in the package.
+	factories     []*protogen.Message
+	factoryOwners map[protogen.GoIdent]*protogen.File
+
+	enums []*protogen.Enum // enums of other packages to alias, may be empty
+}
+
+// contractsData is the data the "contracts" template is executed with.
+type contractsData struct {
+	Service   string // service name
+	Client    string // client interface the tests are run with
+	Contracts string // suite type
+	Test      string // unexported type of the tests of the suite
+
+	// The functions protoc-gen-go-grpc generates, used to run the suite
+	// against a server. Empty with interfaces_only, which replaces
+	// protoc-gen-go-grpc.
+	Server    string // server interface
+	Register  string // Register<Service>Server
+	NewClient string // New<Service>Client
+}
+
+// contractsData prepares the contract test suite of s.
+func (g *generator) contractsData(s *protogen.Service) *contractsData {
+	data := &contractsData{
+		Service:   s.GoName,
+		Client:    g.sourceType(grpcmodel.ClientInterfaceName(s)),
+		Contracts: s.GoName + "Contracts",
+		Test:      strings.ToLower(s.GoName[:1]) + s.GoName[1:] + "Contract",
+	}
+	if !g.ifacesOnly {
+		data.Server = g.sourceType(grpcmodel.ServerInterfaceName(s))
+		data.Register = g.sourceType("Register" + grpcmodel.ServerInterfaceName(s))
+		data.NewClient = g.sourceType("New" + grpcmodel.ClientInterfaceName(s))
+	}
+	return data
+}
+
+// harnessData is the data the "interceptor_harness" template is executed
+// with.
+type harnessData struct {
+	Service string // service name
+	Server  string // server interface
+	Any     string // spelling of the empty interface
+	Methods []harnessMethod
+}
+
+// harnessMethod is the harness function of a method.
+type harnessMethod struct {
+	Name         string // harness function, Intercept<Service>_<Method>
+	Method       string
+	FullMethod   string // method name as grpc reports it to interceptors
+	Request      string // request message type, unary methods only
+	Response     string // response message type, unary methods only
+	Stream       bool
+	ClientStream bool
+	ServerStream bool
+	Desc         string // grpc.StreamDesc of the method in the service desc, streams only
+}
+
+// harnessData prepares the interceptor harness of s. Stream handlers are
+// taken from the service desc protoc-gen-go-grpc declares, as the stream
+// types they wrap the stream in are unexported.
+func (g *generator) harnessData(s *protogen.Service) *harnessData {
+	d := &harnessData{
+		Service: s.GoName,
+		Server:  g.sourceType(grpcmodel.ServerInterfaceName(s)),
+		Any:     g.emptyInterface(),
+	}
+	streams := 0
+	for _, m := range s.Methods {
+		hm := harnessMethod{
+			Name:         "Intercept" + s.GoName + "_" + m.GoName,
+			Method:       m.GoName,
+			FullMethod:   fmt.Sprintf("/%s/%s", s.Desc.FullName(), m.Desc.Name()),
+			ClientStream: m.Desc.IsStreamingClient(),
+			ServerStream: m.Desc.IsStreamingServer(),
+		}
+		if hm.ClientStream || hm.ServerStream {
+			hm.Stream = true
+			hm.Desc = fmt.Sprintf("%s.Streams[%d]", g.sourceType(s.GoName+"_ServiceDesc"), streams)
+			streams++
+		} else {
+			hm.Request = g.gf.QualifiedGoIdent(m.Input.GoIdent)
+			hm.Response = g.gf.QualifiedGoIdent(m.Output.GoIdent)
+		}
+		d.Methods = append(d.Methods, hm)
+	}
+	return d
+}
+
+// unimplementedData is the data the "unimplemented" template is executed
+// with.
+type unimplementedData struct {
+	Server        string // server interface
+	Unimplemented string // Unimplemented<Service>Server type
+	Embedded      string // Unimplemented unqualified, the name of the embedded field
+	Mock          string // mock of the server interface
+	Partial       string // helper, Partial<Service>Server
+	Type          string // unexported type Partial returns
+	Any           string // spelling of the empty interface
+	Methods       []*methodData
+}
+
+// unimplementedData prepares the helpers of s, whose server interface is
+// intf.
+func (g *generator) unimplementedData(s *protogen.Service, intf *grpcmodel.Interface) *unimplementedData {
+	server := grpcmodel.ServerInterfaceName(s)
+	d := &unimplementedData{
+		Server:        g.sourceType(server),
+		Unimplemented: g.sourceType("Unimplemented" + server),
+		Embedded:      "Unimplemented" + server,
+		Mock:          g.mockName(server),
+		Partial:       "Partial" + server,
+		Type:          "partial" + server,
+		Any:           g.emptyInterface(),
+	}
+	for _, m := range intf.Methods {
+		d.Methods = append(d.Methods, g.mockMethodData(d.Type, server, m))
+	}
+	return d
+}
+
+// findInterface returns the interface of pkg named name, or nil.
+func findInterface(pkg *grpcmodel.Package, name string) *grpcmodel.Interface {
+	for _, intf := range pkg.Interfaces {
+		if intf.Name == name {
+			return intf
+		}
+	}
+	return nil
+}
+
+// derivedInterface is an interface declared along with its mock.
+type derivedInterface struct {
+	parent   string // client interface it is derived from
+	template string // name of the template declaring it
+}
+
+func (g *generator) p(format string, args ...interface{}) {
+	g.gf.P(fmt.Sprintf(format, args...))
+}
+
+func (g *generator) Generate(pkg *grpcmodel.Package, outputPkgName string) error {
+	if err := g.generateHeader(outputPkgName); err != nil {
+		return err
+	}
+	for _, intf := range pkg.Interfaces {
+		if err := g.GenerateMockInterface(intf); err != nil {
+			return err
+		}
+	}
+	for _, s := range g.contracts {
+		var buf strings.Builder
+		if err := g.templates.ExecuteTemplate(&buf, "contracts", g.contractsData(s)); err != nil {
+			return fmt.Errorf("failed to render contracts for %s: %w", s.Desc.FullName(), err)
+		}
+		g.gf.P(buf.String())
+	}
+	for _, s := range g.harnesses {
+		var buf strings.Builder
+		if err := g.templates.ExecuteTemplate(&buf, "interceptor_harness", g.harnessData(s)); err != nil {
+			return fmt.Errorf("failed to render interceptor harness for %s: %w", s.Desc.FullName(), err)
+		}
+		g.gf.P(buf.String())
+	}
+	for _, s := range g.unimplemented {
+		intf := findInterface(pkg, grpcmodel.ServerInterfaceName(s))
+		if intf == nil {
+			continue // removed by a hook
+		}
+		var buf strings.Builder
+		if err := g.templates.ExecuteTemplate(&buf, "unimplemented", g.unimplementedData(s, intf)); err != nil {
+			return fmt.Errorf("failed to render unimplemented helpers for %s: %w", s.Desc.FullName(), err)
+		}
+		g.gf.P(buf.String())
+	}
+	for _, msg := range g.builders {
+		var buf strings.Builder
+		if err := g.templates.ExecuteTemplate(&buf, "builder", g.builderData(msg)); err != nil {
+			return fmt.Errorf("failed to render builder for %s: %w", msg.Desc.FullName(), err)
+		}
+		g.gf.P(buf.String())
+	}
+	for _, msg := range g.fixtures {
+		var buf strings.Builder
+		if err := g.templates.ExecuteTemplate(&buf, "fixture", g.fixtureData(msg)); err != nil {
+			return fmt.Errorf("failed to render fixture helpers for %s: %w", msg.Desc.FullName(), err)
+		}
+		g.gf.P(buf.String())
+	}
+	for _, msg := range g.matchers {
+		var buf strings.Builder
+		if err := g.templates.ExecuteTemplate(&buf, "matcher", g.matcherData(msg)); err != nil {
+			return fmt.Errorf("failed to render matcher for %s: %w", msg.Desc.FullName(), err)
+		}
+		g.gf.P(buf.String())
+	}
+	for _, msg := range g.factories {
+		var buf strings.Builder
+		if err := g.templates.ExecuteTemplate(&buf, "factory", g.factoryData(msg)); err != nil {
+			return fmt.Errorf("failed to render factory for %s: %w", msg.Desc.FullName(), err)
+		}
+		g.gf.P(buf.String())
+	}
+	for _, enum := range g.enums {
+		var buf strings.Builder
+		if err := g.templates.ExecuteTemplate(&buf, "enum", g.enumData(enum)); err != nil {
+			return fmt.Errorf("failed to render aliases of %s: %w", enum.Desc.FullName(), err)
+		}
+		g.gf.P(buf.String())
+	}
+	return nil
+}
+
+// GenerateStreamMocks generates the shared stream mocks.
+func (g *generator) GenerateStreamMocks(outputPkgName string) error {
+	if err := g.generateHeader(outputPkgName); err != nil {
+		return err
+	}
+	bases := []struct {
+		name, intf string
+		methods    []*grpcmodel.Method
+	}{
+		{baseClientStreamMock, "grpc.ClientStream", grpcmodel.BaseClientStreamMethods()},
+		{baseServerStreamMock, "grpc.ServerStream", grpcmodel.BaseServerStreamMethods()},
+	}
+	for _, base := range bases {
+		sort.Sort(byMethodName(base.methods))
+		data := &mockData{
+			MockType:  base.name,
+			Interface: base.intf,
+			Any:       g.emptyInterface(),
+		}
+		for _, m := range base.methods {
+			d := g.mockMethodData(base.name, "", m)
+			d.Mock = d.Recv + ".mock"
+			d.RecorderMock = d.RecorderRecv + ".mock.mock"
+			data.Methods = append(data.Methods, d)
+		}
+		var buf strings.Builder
+		if err := g.templates.ExecuteTemplate(&buf, "stream_mock", data); err != nil {
+			return fmt.Errorf("failed to render %s: %w", base.name, err)
+		}
+		g.gf.P(buf.String())
+	}
+	return nil
+}
+
+// GenerateGRPCMocks generates standalone mocks of grpc.ServerStream,
+// grpc.ClientStream and grpc.ServerTransportStream, for tests of interceptors
+// and other middleware, the FakeServerStream and FakeClientStream fakes
+// checking the streams interceptors wrap them in, and the Registrar fake of
+// grpc.ServiceRegistrar.
+func (g *generator) GenerateGRPCMocks(outputPkgName string) error {
+	if err := g.generateHeader(outputPkgName); err != nil {
+		return err
+	}
+	intfs := []*grpcmodel.Interface{
+		{Name: "ClientStream", Methods: grpcmodel.BaseClientStreamMethods()},
+		{Name: "ServerStream", Methods: grpcmodel.BaseServerStreamMethods()},
+		{Name: "ServerTransportStream", Methods: grpcmodel.ServerTransportStreamMethods()},
+	}
+	for _, intf := range intfs {
+		if err := g.GenerateMockInterface(intf); err != nil {
+			return err
+		}
+	}
+	data := struct {
+		Any      string
+		Generics bool // generate the typed stream fakes, which need Go 1.18
+	}{g.emptyInterface(), g.goMinor >= 18}
+	for _, name := range []string{"stream_fakes", "registrar"} {
+		var buf strings.Builder
+		if err := g.templates.ExecuteTemplate(&buf, name, data); err != nil {
+			return fmt.Errorf("failed to render %s: %w", name, err)
+		}
+		g.gf.P(buf.String())
+	}
+	return nil
+}
+
+// skeletonData is the data the "test_skeleton" template is executed with.
+type skeletonData struct {
+	Client  string // client interface
+	Mock    string // mock of the client interface
+	Expect  string // name of the EXPECT method of the mock
+	Methods []skeletonMethod
+}
+
+// skeletonMethod is the test skeleton of a unary method.
+type skeletonMethod struct {
+	Name     string
+	Test     string // test function, Test<Client>_<Method>
+	Request  string // request message type
+	Response string // response message type
+}
+
+// GenerateTestSkeletons generates test skeletons of the unary methods of the
+// clients of services.
+func (g *generator) GenerateTestSkeletons(services []*protogen.Service, outputPkgName string) error {
+	if err := g.generateHeader(outputPkgName); err != nil {
+		return err
+	}
+	for _, s := range services {
+		client := grpcmodel.ClientInterfaceName(s)
+		mock := &mockData{taken: make(map[string]bool)}
+		for _, m := range s.Methods {
+			mock.taken[m.GoName] = true
+		}
+		data := &skeletonData{
+			Client: client,
+			Mock:   g.mockName(client),
+			Expect: mock.Member("EXPECT"),
+		}
+		for _, m := range s.Methods {
+			if grpcmodel.MethodTypeOf(m) != grpcmodel.MethodTypeUnary {
+				continue
+			}
+			data.Methods = append(data.Methods, skeletonMethod{
+				Name:     m.GoName,
+				Test:     "Test" + client + "_" + m.GoName,
+				Request:  "*" + g.gf.QualifiedGoIdent(m.Input.GoIdent),
+				Response: "*" + g.gf.QualifiedGoIdent(m.Output.GoIdent),
+			})
+		}
+		var buf strings.Builder
+		if err := g.templates.ExecuteTemplate(&buf, "test_skeleton", data); err != nil {
+			return fmt.Errorf("failed to render test skeletons for %s: %w", s.Desc.FullName(), err)
+		}
+		g.gf.P(buf.String())
+	}
+	return nil
+}
+
+// GenerateFuzzTargets generates the fuzz targets of services, and reports
+// how many it generated.
+func (g *generator) GenerateFuzzTargets(services []*protogen.Service, outputPkgName string) (int, error) {
+	if err := g.generateHeader(outputPkgName); err != nil {
+		return 0, err
+	}
+	var n int
+	for _, s := range services {
+		data := g.fuzzData(s)
+		if len(data.Methods) == 0 {
+			continue
+		}
+		var buf strings.Builder
+		if err := g.templates.ExecuteTemplate(&buf, "fuzz", data); err != nil {
+			return 0, fmt.Errorf("failed to render fuzz targets for %s: %w", s.Desc.FullName(), err)
+		}
+		g.gf.P(buf.String())
+		n += len(data.Methods)
+	}
+	return n, nil
+}
+
+// exampleData is the data the "example" template is executed with.
+type exampleData struct {
+	Mock     string // mock of the client interface
+	New      string // constructor of the mock
+	Expect   string // name of the EXPECT method of the mock
+	Method   string // unary method the example calls
+	Request  string // request message type
+	Response string // response message type
+}
+
+// GenerateExamples generates an example of the client mock of each of
+// services in the external test package of the mocks, importPath, calling
+// its first unary method. With reporter, it also declares the reporter the
+// examples of the package share.
+func (g *generator) GenerateExamples(services []*protogen.Service, importPath protogen.GoImportPath, outputPkgName string, reporter bool) error {
+	if err := g.generateHeader(outputPkgName); err != nil {
+		return err
+	}
+	if reporter {
+		var buf strings.Builder
+		if err := g.templates.ExecuteTemplate(&buf, "example_reporter", g.emptyInterface()); err != nil {
+			return fmt.Errorf("failed to render example reporter: %w", err)
+		}
+		g.gf.P(buf.String())
+	}
+	for _, s := range services {
+		client := grpcmodel.ClientInterfaceName(s)
+		mock := &mockData{taken: make(map[string]bool)}
+		for _, m := range s.Methods {
+			mock.taken[m.GoName] = true
+		}
+		for _, m := range s.Methods {
+			if grpcmodel.MethodTypeOf(m) != grpcmodel.MethodTypeUnary {
+				continue
+			}
+			data := &exampleData{
+				Mock:     g.mockName(client),
+				New:      g.gf.QualifiedGoIdent(importPath.Ident("New" + g.mockName(client))),
+				Expect:   mock.Member("EXPECT"),
+				Method:   m.GoName,
+				Request:  g.gf.QualifiedGoIdent(m.Input.GoIdent),
+				Response: g.gf.QualifiedGoIdent(m.Output.GoIdent),
+			}
+			var buf strings.Builder
+			if err := g.templates.ExecuteTemplate(&buf, "example", data); err != nil {
+				return fmt.Errorf("failed to render example for %s: %w", s.Desc.FullName(), err)
+			}
+			g.gf.P(buf.String())
+			break
+		}
+	}
+	return nil
+}
+
+// generateHeader writes everything preceding the mocks and binds the
+// templates to the file.
+func (g *generator) generateHeader(outputPkgName string) error {
+	if g.buildConstraints != "" {
+		g.p("//go:build %s", g.buildConstraints)
+		g.p("")
+	}
+
+	if g.copyrightHeader != "" {
+		lines := strings.Split(g.copyrightHeader, "\n")
+		for _, line := range lines {
+			g.p("// %s", line)
+		}
+		g.p("")
+	}
+
+	g.p("// Code generated by protoc-gen-go-grpc-mock. DO NOT EDIT.")
+	if len(g.versions) > 0 {
+		width := 0
+		for _, v := range g.versions {
+			if len(v[0]) > width {
+				width = len(v[0])
+			}
+		}
+		g.p("// versions:")
+		for _, v := range g.versions {
+			g.p("// - %-*s %s", width, v[0], v[1])
+		}
+	}
+	if g.filename != "" {
+		g.p("// source: %v", g.filename)
+	}
+	g.p("")
+	g.p("package %v", outputPkgName)
+
+	// Templates are shared by all files, the functions qualifying
+	// identifiers are bound to this file.
+	tmpl, err := g.templates.Clone()
+	if err != nil {
+		return err
+	}
+	g.templates = tmpl.Funcs(g.templateFuncs())
+	return nil
+}
+
+// templateFuncs returns the functions available to templates. ident
+// qualifies an identifier of any package, gomock, reflect, testify and
+// minimock are shorthands for the packages the built-in templates use.
+func (g *generator) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"ident": func(importPath, name string) string {
+			return g.gf.QualifiedGoIdent(protogen.GoImportPath(importPath).Ident(name))
+		},
+		"gomock": func(name string) string {
+			return g.gf.QualifiedGoIdent(gomockPackage.Ident(name))
+		},
+		"reflect": func(name string) string {
+			return g.gf.QualifiedGoIdent(reflectPackage.Ident(name))
+		},
+		"testify": func(name string) string {
+			return g.gf.QualifiedGoIdent(testifyPackage.Ident(name))
+		},
+		"minimock": func(name string) string {
+			return g.gf.QualifiedGoIdent(minimockPackage.Ident(name))
+		},
+	}
+}
+
+// sourceType returns the type name declared in the package of the mocked
+// interfaces, qualified if the mocks are written to another package.
+func (g *generator) sourceType(name string) string {
+	return g.gf.QualifiedGoIdent(g.source.Ident(name))
+}
+
+// The name of the mock type to use for the given interface identifier.
+func (g *generator) mockName(typeName string) string {
+	if mockName := g.overrides[typeName].name; mockName != "" {
+		return mockName
+	}
+
+	return "Mock" + typeName
+}
+
+// framework returns the mocking library the mock of the given interface is
+// written for.
+func (g *generator) framework(typeName string) string {
+	if framework := g.overrides[typeName].framework; framework != "" {
+		return framework
+	}
+	return *framework
+}
+
+type mockData struct {
+	MockType      string
+	Interface     string
+	Parent        string          // client interface a derived interface is derived from, may be empty
+	ParentType    string          // Parent qualified for use as a type
+	Base          string          // shared stream mock embedded in the mock, may be empty
+	Unimplemented string          // Unimplemented<Service>Server embedded in the mock, may be empty
+	Sent          string          // type of the messages recorded by Send, empty if they are not
+	Scripted      bool            // generate setters scripting Header and Trailer
+	LogCalls      bool            // generate LogCalls, see methodData.LogCalls
+	Any           string          // spelling of the empty interface
+	Comment       []string        // copied proto comment lines, may be empty
+	Deprecated    bool            // the service or method the interface was generated from is deprecated
+	Renamed       []renamedMember // members Member renamed
+	Methods       []*methodData
+
+	members map[string]string // see Member
+	taken   map[string]bool   // method names of the interface and allocated members
+}
+
+// renamedMember is a member of a mock declared under another name.
+type renamedMember struct {
+	Name   string
+	Member string
+}
+
+// Member returns the name the mock declares its own member name as. It is
+// name itself unless a method of the interface has that name, in which case
+// underscores are appended until it is unique.
+func (d *mockData) Member(name string) string {
+	if member, ok := d.members[name]; ok {
+		return member
+	}
+	member := name
+	for d.taken[member] {
+		member += "_"
+	}
+	if member != name {
+		d.Renamed = append(d.Renamed, renamedMember{Name: name, Member: member})
+	}
+	if d.members == nil {
+		d.members = make(map[string]string)
+	}
+	if d.taken == nil {
+		d.taken = make(map[string]bool)
+	}
+	d.members[name] = member
+	d.taken[member] = true
+	return member
+}
+
+// methodData is the data the "method" and "recorder" templates are executed
+// with. Identifiers are allocated up front so they never collide with the
+// method's argument names.
+type methodData struct {
+	MockType   string
+	Name       string
+	Comment    []string // copied proto comment lines, may be empty
+	Deprecated bool     // the method was generated from a deprecated method
+	Any        string   // spelling of the empty interface
+	Record     bool     // record the argument of Send, see mockData.Sent
+	Retry      string   // gomock.Any() matchers of all arguments, set to generate a FailsThenSucceeds helper
+	Retrier    string   // name of the FailsThenSucceeds helper
+	LogCalls   bool     // log the call with the function passed to LogCalls
+
+	Recv       string // receiver of the mock method
+	Mock       string // mock the call is recorded for, usually Recv
+	Params     string // parameter list of the mock method
+	ParamTypes string // parameter types of the mock method, comma-separated
+	Results    string // result list of the mock method, including a leading space
+
+	Args         []paramData // non-variadic arguments
+	VariadicType string      // element type of the variadic argument, may be empty
+	ArgNames     string      // names of all arguments, comma-separated
+	CalledArgs   string      // arguments a call is recorded with, e.g. "ctx, in" or "varargs..."
+	PassArgs     string      // arguments passed on to a function of the method's signature
+	Func         string      // name of a function value the results are computed with
+
+	FixedArgs   string // non-variadic argument names, comma-separated
+	VariadicArg string // name of the variadic argument, may be empty
+	VarArgs     string // slice collecting all arguments of a variadic method
+	VarArg      string // loop variable used to fill VarArgs
+	CallArgs    string // trailing arguments passed on to ctrl.Call
+
+	Ret         string // value returned by ctrl.Call
+	Returns     []returnData
+	ReturnNames string
+
+	RecorderRecv     string
+	RecorderMock     string // mock the expected call is recorded for
+	RecorderParams   string
+	RecorderVarArgs  string // slice passed on to RecordCallWithMethodType, may be empty
+	RecorderCallArgs string
+}
+
+type returnData struct {
+	Name string
+	Type string
+}
+
+type paramData struct {
+	Name string
+	Type string
+}
+
+func (g *generator) GenerateMockInterface(intf *grpcmodel.Interface) error {
+	mockType := g.mockName(intf.Name)
+
+	sort.Sort(byMethodName(intf.Methods))
+	data := &mockData{
+		MockType:   mockType,
+		Interface:  intf.Name,
+		Parent:     g.derived[intf.Name].parent,
+		Base:       g.streamBases[intf.Name],
+		Any:        g.emptyInterface(),
+		Comment:    g.comment(intf.Name),
+		Deprecated: g.deprecated[intf.Name],
+		Scripted:   g.scripted[intf.Name],
+		LogCalls:   g.logCalls,
+	}
+	if data.Parent != "" {
+		data.ParentType = g.sourceType(data.Parent)
+	}
+	for _, s := range g.unimplemented {
+		if grpcmodel.ServerInterfaceName(s) == intf.Name {
+			data.Unimplemented = g.sourceType("Unimplemented" + intf.Name)
+		}
+	}
+	if msg, ok := g.sent[intf.Name]; ok {
+		data.Sent = "*" + g.gf.QualifiedGoIdent(msg)
+	}
+	data.taken = make(map[string]bool, len(intf.Methods))
+	for _, m := range intf.Methods {
+		data.taken[m.Name] = true
+	}
+	// Members are allocated before rendering so Renamed is complete when
+	// the doc comment of the mock is.
+	data.Member("EXPECT")
+	if data.Sent != "" {
+		data.Member("SentMessages")
+		data.Member("AssertSentInOrder")
+	}
+	if data.LogCalls {
+		data.Member("LogCalls")
+	}
+	if data.Scripted {
+		data.Member("ReturnHeader")
+		data.Member("ReturnTrailer")
+	}
+	var shared map[string]bool
+	if data.Base != "" && !g.ifacesOnly {
+		shared = streamMethodNames(data.Base)
+	}
+	for _, m := range intf.Methods {
+		if shared[m.Name] {
+			continue
+		}
+		d := g.mockMethodData(mockType, intf.Name, m)
+		d.Record = data.Sent != "" && m.Name == "Send"
+		d.LogCalls = g.logCalls
+		if g.retried[intf.Name] && len(m.Out) == 2 && g.typeString(m.Out[1].Type) == "error" {
+			d.Retry = g.anyMatchers(m)
+			d.Retrier = data.Member(m.Name + "FailsThenSucceeds")
+		}
+		data.Methods = append(data.Methods, d)
+	}
+
+	var buf strings.Builder
+	decl := g.derived[intf.Name].template
+	if decl == "" && g.ifacesOnly {
+		decl = "interface"
+	}
+	if decl != "" {
+		if err := g.templates.ExecuteTemplate(&buf, decl, data); err != nil {
+			return fmt.Errorf("failed to render interface %s: %w", intf.Name, err)
+		}
+	}
+	if !g.ifacesOnly {
+		if err := g.templates.ExecuteTemplate(&buf, frameworkTemplates[g.framework(intf.Name)], data); err != nil {
+			return fmt.Errorf("failed to render mock for %s: %w", intf.Name, err)
+		}
+	}
+	g.gf.P(buf.String())
+	return nil
+}
+
+// anyMatchers returns gomock.Any() for every argument of m, comma-separated.
+func (g *generator) anyMatchers(m *grpcmodel.Method) string {
+	n := len(m.In)
+	if m.Variadic != nil {
+		n++
+	}
+	matchers := make([]string, n)
+	for i := range matchers {
+		matchers[i] = g.gf.QualifiedGoIdent(gomockPackage.Ident("Any")) + "()"
+	}
+	return strings.Join(matchers, ", ")
+}
+
+// streamMethodNames returns the names of the methods the shared stream mock
+// base implements.
+func streamMethodNames(base string) map[string]bool {
+	methods := grpcmodel.BaseClientStreamMethods()
+	if base == baseServerStreamMock {
+		methods = grpcmodel.BaseServerStreamMethods()
+	}
+	names := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		names[m.Name] = true
+	}
+	return names
+}
+
+type byMethodName []*grpcmodel.Method
+
+func (b byMethodName) Len() int           { return len(b) }
+func (b byMethodName) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byMethodName) Less(i, j int) bool { return b[i].Name < b[j].Name }
+
+// comment returns the lines of the source comment recorded for key, if any.
+func (g *generator) comment(key string) []string {
+	text, ok := g.comments[key]
+	if !ok {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+func makeArgString(argNames, argTypes []string) string {
+	args := make([]string, len(argNames))
+	for i, name := range argNames {
+		// specify the type only once for consecutive args of the same type
+		if i+1 < len(argTypes) && argTypes[i] == argTypes[i+1] {
+			args[i] = name
+		} else {
+			args[i] = name + " " + argTypes[i]
+		}
+	}
+	return strings.Join(args, ", ")
+}
+
+// mockMethodData prepares a mock method implementation and its recorder.
+func (g *generator) mockMethodData(mockType, intfName string, m *grpcmodel.Method) *methodData {
+	argNames := g.getArgNames(m)
+	argTypes := g.getArgTypes(m)
+
+	rets := make([]string, len(m.Out))
+	for i, p := range m.Out {
+		rets[i] = g.typeString(p.Type)
+	}
+	retString := strings.Join(rets, ", ")
+	if len(rets) > 1 {
+		retString = "(" + retString + ")"
+	}
+	if retString != "" {
+		retString = " " + retString
+	}
+
+	d := &methodData{
+		MockType:   mockType,
+		Name:       m.Name,
+		Comment:    g.comment(intfName + "." + m.Name),
+		Deprecated: g.deprecated[intfName+"."+m.Name],
+		Any:        g.emptyInterface(),
+		Params:     makeArgString(argNames, argTypes),
+		Results:    retString,
+
+		ParamTypes: strings.Join(argTypes, ", "),
+		ArgNames:   strings.Join(argNames, ", "),
+		PassArgs:   strings.Join(argNames, ", "),
+	}
+	for i := range m.In {
+		d.Args = append(d.Args, paramData{Name: argNames[i], Type: argTypes[i]})
+	}
+	if m.Variadic != nil {
+		d.VariadicType = g.typeString(m.Variadic.Type)
+		d.PassArgs += "..."
+	}
+
+	ia := newIdentifierAllocator(argNames)
+	d.Recv = ia.allocateIdentifier("m")
+	d.Mock = d.Recv
+
+	if m.Variadic == nil {
+		d.CalledArgs = strings.Join(argNames, ", ")
+	} else {
+		// Non-trivial. The generated code must build a []interface{},
+		// but the variadic argument may be any type.
+		d.FixedArgs = strings.Join(argNames[:len(argNames)-1], ", ")
+		d.VariadicArg = argNames[len(argNames)-1]
+		d.VarArgs = ia.allocateIdentifier("varargs")
+		d.VarArg = ia.allocateIdentifier("a")
+		d.CalledArgs = d.VarArgs + "..."
+	}
+	if d.CalledArgs != "" {
+		d.CallArgs = ", " + d.CalledArgs
+	}
+	if len(m.Out) > 0 {
+		d.Ret = ia.allocateIdentifier("ret")
+		d.Func = ia.allocateIdentifier("rf")
+
+		// Go does not allow "naked" type assertions on nil values, so we use the two-value form here.
+		// The value of that is either (x.(T), true) or (Z, false), where Z is the zero value for T.
+		// Happily, this coincides with the semantics we want here.
+		retNames := make([]string, len(rets))
+		for i, t := range rets {
+			retNames[i] = ia.allocateIdentifier(fmt.Sprintf("ret%d", i))
+			d.Returns = append(d.Returns, returnData{Name: retNames[i], Type: t})
+		}
+		d.ReturnNames = strings.Join(retNames, ", ")
+	}
+
+	g.recorderMethodData(d, m, argNames)
+	return d
+}
+
+// recorderMethodData fills in the recorder method for a mock method.
+func (g *generator) recorderMethodData(d *methodData, m *grpcmodel.Method, argNames []string) {
+	var argString string
+	if m.Variadic == nil {
+		argString = strings.Join(argNames, ", ")
+	} else {
+		argString = strings.Join(argNames[:len(argNames)-1], ", ")
+	}
+	if argString != "" {
+		argString += " " + g.emptyInterface()
+	}
+
+	if m.Variadic != nil {
+		if argString != "" {
+			argString += ", "
+		}
+		argString += fmt.Sprintf("%s ...%s", argNames[len(argNames)-1], g.emptyInterface())
+	}
+	d.RecorderParams = argString
+
+	ia := newIdentifierAllocator(argNames)
+	d.RecorderRecv = ia.allocateIdentifier("mr")
+	d.RecorderMock = d.RecorderRecv + ".mock"
+
+	if m.Variadic == nil {
+		if len(argNames) > 0 {
+			d.RecorderCallArgs = ", " + strings.Join(argNames, ", ")
+		}
+	} else {
+		if len(argNames) == 1 {
+			// Easy: just use ... to push the arguments through.
+			d.RecorderCallArgs = ", " + argNames[0] + "..."
+		} else {
+			// Hard: create a temporary slice.
+			d.RecorderVarArgs = ia.allocateIdentifier("varargs")
+			d.RecorderCallArgs = ", " + d.RecorderVarArgs + "..."
+		}
+	}
+}
+
+func (g *generator) getArgNames(m *grpcmodel.Method) []string {
+	argNames := make([]string, len(m.In))
+	for i, p := range m.In {
+		name := p.Name
+		if name == "" || name == "_" {
+			name = fmt.Sprintf("arg%d", i)
+		}
+		argNames[i] = name
+	}
+	if m.Variadic != nil {
+		name := m.Variadic.Name
+		if name == "" {
+			name = fmt.Sprintf("arg%d", len(m.In))
+		}
+		argNames = append(argNames, name)
+	}
+	return argNames
+}
+
+func (g *generator) getArgTypes(m *grpcmodel.Method) []string {
+	argTypes := make([]string, len(m.In))
+	for i, p := range m.In {
+		argTypes[i] = g.typeString(p.Type)
+	}
+	if m.Variadic != nil {
+		argTypes = append(argTypes, "..."+g.typeString(m.Variadic.Type))
+	}
+	return argTypes
+}
+
+// typeString renders t, qualifying named types with the package they are
+// imported as. Named types without a package live in the output package.
+func (g *generator) typeString(t grpcmodel.Type) string {
+	switch t := t.(type) {
+	case *grpcmodel.NamedType:
+		name := t.Type
+		if t.Package != "" {
+			name = g.gf.QualifiedGoIdent(protogen.GoImportPath(t.Package).Ident(t.Type))
+		}
+		if len(t.TypeArgs) > 0 {
+			args := make([]string, len(t.TypeArgs))
+			for i, arg := range t.TypeArgs {
+				args[i] = g.typeString(arg)
+			}
+			name += "[" + strings.Join(args, ", ") + "]"
+		}
+		return name
+	case *grpcmodel.PointerType:
+		return "*" + g.typeString(t.Type)
+	case grpcmodel.PredeclaredType:
+		if t == "interface{}" {
+			return g.emptyInterface()
+		}
+		return string(t)
+	case *grpcmodel.ArrayType:
+		if t.Len < 0 {
+			return "[]" + g.typeString(t.Type)
+		}
+		return "[" + strconv.Itoa(t.Len) + "]" + g.typeString(t.Type)
+	case *grpcmodel.MapType:
+		return "map[" + g.typeString(t.Key) + "]" + g.typeString(t.Value)
+	default:
+		panic(fmt.Sprintf("unsupported model type %T", t))
+	}
+}
+
+// emptyInterface returns the spelling of the empty interface type.
+func (g *generator) emptyInterface() string {
+	if g.useAny {
+		return "any"
+	}
+	return "interface{}"
+}
+
+type identifierAllocator map[string]struct{}
+
+func newIdentifierAllocator(taken []string) identifierAllocator {
+	a := make(identifierAllocator, len(taken))
+	for _, s := range taken {
+		a[s] = struct{}{}
+	}
+	return a
+}
+
+func (o identifierAllocator) allocateIdentifier(want string) string {
+	id := want
+	for i := 2; ; i++ {
+		if _, ok := o[id]; !ok {
+			o[id] = struct{}{}
+			return id
+		}
+		id = want + "_" + strconv.Itoa(i)
+	}
+}
+
+// format applies the configured import grouping and formatter to the
+// content protogen rendered for the file.
+func (g *generator) format(src []byte) ([]byte, error) {
+	src, err := toolsimports.Process("", src, &toolsimports.Options{
+		Comments:   true,
+		TabIndent:  true,
+		TabWidth:   8,
+		FormatOnly: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated source code: %w", err)
+	}
+	if g.gofumpt {
+		src, err = gofumpt.Source(src, gofumpt.Options{LangVersion: fmt.Sprintf("1.%d", g.goMinor)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to gofumpt generated source code: %w", err)
+		}
+	}
+	return src, nil
+}
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// placeholderFuncs declares the template functions so templates can be
+// parsed once, before generator.templateFuncs binds them to a file.
+var placeholderFuncs = template.FuncMap{
+	"ident":    func(importPath, name string) string { return name },
+	"gomock":   func(name string) string { return name },
+	"reflect":  func(name string) string { return name },
+	"testify":  func(name string) string { return name },
+	"minimock": func(name string) string { return name },
+}
+
+// loadTemplates parses the built-in templates and then any *.tmpl files in
+// dir, whose definitions replace the built-in ones of the same name.
+func loadTemplates(dir string) (*template.Template, error) {
+	tmpl, err := template.New("").Funcs(placeholderFuncs).ParseFS(defaultTemplates, "templates/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return tmpl, nil
+	}
+	overrides, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	if len(overrides) == 0 {
+		return nil, fmt.Errorf("no *.tmpl files found in templates_dir %q", dir)
+	}
+	return tmpl.ParseFiles(overrides...)
+}
@@ -3,14 +3,25 @@ module github.com/sorcererxw/protoc-gen-go-grpc-mock
 go 1.20
 
 require (
+	github.com/bufbuild/protocompile v0.6.0
+	github.com/gojuno/minimock/v3 v3.3.6
+	github.com/stretchr/testify v1.8.4
 	go.uber.org/mock v0.2.0
+	golang.org/x/sync v0.3.0
 	golang.org/x/tools v0.12.0
 	google.golang.org/grpc v1.57.0
+	google.golang.org/grpc/cmd/protoc-gen-go-grpc v1.3.0
 	google.golang.org/protobuf v1.31.0
+	gopkg.in/yaml.v3 v3.0.1
+	mvdan.cc/gofumpt v0.5.0
 )
 
 require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/google/go-cmp v0.5.9 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/stretchr/objx v0.5.0 // indirect
 	golang.org/x/mod v0.12.0 // indirect
 	golang.org/x/net v0.14.0 // indirect
 	golang.org/x/sys v0.11.0 // indirect
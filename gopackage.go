@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// resolveGoPackages makes sure protogen can tell the Go import path of every
+// file in req. Files without a go_package option or an M parameter are
+// mapped below the go_package_fallback import path, mirroring their
+// directory, and without it an error names each of them along with the
+// option that would fix it.
+func resolveGoPackages(req *pluginpb.CodeGeneratorRequest) error {
+	mapped := make(map[string]bool)
+	for _, param := range strings.Split(req.GetParameter(), ",") {
+		if k, _, ok := strings.Cut(param, "="); ok && strings.HasPrefix(k, "M") {
+			mapped[k[1:]] = true
+		}
+	}
+	var missing []string
+	for _, file := range req.ProtoFile {
+		if file.GetOptions().GetGoPackage() == "" && !mapped[file.GetName()] {
+			missing = append(missing, file.GetName())
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	fallback := requestParam(req, "go_package_fallback")
+	if fallback == "" {
+		var b strings.Builder
+		fmt.Fprintf(&b, "unable to determine the Go package of %d file(s):\n", len(missing))
+		for _, name := range missing {
+			fmt.Fprintf(&b, "  %s: add option go_package = %q;\n", name, path.Join("example.com/yourmodule", path.Dir(name)))
+		}
+		b.WriteString("or pass M<file>=<import path> for each of them, or go_package_fallback=<import path> to place them below it by directory")
+		return fmt.Errorf("%s", b.String())
+	}
+	params := req.GetParameter()
+	for _, name := range missing {
+		params += ",M" + name + "=" + path.Join(fallback, path.Dir(name))
+	}
+	req.Parameter = proto.String(strings.TrimPrefix(params, ","))
+	return nil
+}
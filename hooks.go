@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"plugin"
+	"strings"
+
+	"google.golang.org/protobuf/compiler/protogen"
+
+	"github.com/sorcererxw/protoc-gen-go-grpc-mock/pkg/grpcmodel"
+)
+
+// hookSymbol is the function a hook plugin must export. It has the signature
+// of hookFunc and is called with the model of every file mocks are generated
+// for, after the model has been built and before any code is rendered.
+const hookSymbol = "TransformPackage"
+
+// hookFunc transforms the model of a proto file in place. Returning an error
+// aborts generation.
+type hookFunc = func(file *protogen.File, pkg *grpcmodel.Package) error
+
+// hookPaths collects the repeated hook= parameter.
+type hookPaths []string
+
+func (h *hookPaths) String() string { return strings.Join(*h, ",") }
+
+func (h *hookPaths) Set(path string) error {
+	*h = append(*h, path)
+	return nil
+}
+
+// loadHooks opens the Go plugins at paths and looks up their hook functions.
+// Plugins must be built with the same Go toolchain and dependency versions as
+// this binary, see https://pkg.go.dev/plugin.
+func loadHooks(paths []string) ([]hookFunc, error) {
+	hooks := make([]hookFunc, 0, len(paths))
+	for _, path := range paths {
+		p, err := plugin.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed opening hook plugin: %w", err)
+		}
+		sym, err := p.Lookup(hookSymbol)
+		if err != nil {
+			return nil, fmt.Errorf("hook plugin %s: %w", path, err)
+		}
+		hook, ok := sym.(hookFunc)
+		if !ok {
+			return nil, fmt.Errorf("hook plugin %s: %s has type %T, want %T", path, hookSymbol, sym, hook)
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
@@ -1,414 +1,1006 @@
 package main
 
 import (
-	_ "embed"
+	"flag"
 	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
 
-	"go.uber.org/mock/mockgen/model"
+	"golang.org/x/sync/errgroup"
+	toolsimports "golang.org/x/tools/imports"
 	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/pluginpb"
+
+	"github.com/sorcererxw/protoc-gen-go-grpc-mock/pkg/grpcmodel"
 )
 
-type methodType int
+var (
+	cmdFlags    = flag.NewFlagSet("protoc-gen-go-grpc-mock", flag.ExitOnError)
+	showVersion = cmdFlags.Bool("version", false, "print the version and exit")
+	replayFile  = cmdFlags.String("replay", "", "regenerate from a request saved with debug_request_file instead of reading stdin")
+	replayOut   = cmdFlags.String("out", ".", "directory generated files are written to with -replay")
+)
 
-const (
-	methodTypeUnary methodType = iota
-	methodTypeClientStream
-	methodTypeServerStream
-	methodTypeBidirectionalStream
+var (
+	flags          flag.FlagSet
+	copyComments   = flags.Bool("copy_comments", false, "copy leading proto comments onto generated mocks")
+	skipDeprecated = flags.Bool("skip_deprecated", false, "omit the mocks of deprecated services, and the method and stream interfaces of deprecated methods")
+	copyrightFile  = flags.String("copyright_file", "", "path to a file whose contents are prepended as a header comment")
+	buildTags      = flags.String("build_constraints", "", "build constraint expression added as a //go:build line")
+	omitSource     = flags.Bool("omit_source", false, "omit the source proto path from the generated file header")
+	framework      = flags.String("framework", "gomock", "mocking library the generated mocks are written for: gomock, mockery or minimock")
+	formatStyle    = flags.String("format", "goimports", "formatter applied to generated code: goimports or gofumpt")
+	localPrefix    = flags.String("local_prefix", "", "comma-separated import path prefixes grouped after third-party imports")
+	grpcAPI        = flags.String("grpc_api", "", "grpc-go version the generated code targets: v1.58, or v1.64 and latest for its generic stream types")
+	goVersion      = flags.String("go_version", "", "minimum Go version the generated code must compile with, e.g. 1.18")
+	omitVersion    = flags.Bool("omit_version", false, "omit plugin and compiler versions from the generated file header")
+	templatesDir   = flags.String("templates_dir", "", "directory of *.tmpl files overriding the built-in templates")
+	dumpModel      = flags.String("dump_model", "", "write the interface model as JSON: true to add it to the mocks, only to replace them")
+	_              = flags.String("debug_request_file", "", "path the raw CodeGeneratorRequest is written to")
+	_              = flags.String("go_package_fallback", "", "import path files without a go_package option are placed below, by directory")
+	_              = flags.String("config", "", "path of a YAML file setting options, overridden by the parameters")
+	_              = flags.String("profile", "", "preset of options to start from: minimal, standard or full")
+	dryRun         = flags.Bool("dry_run", false, "analyze the request and report what would be generated without writing files")
+	methodIfaces   = flags.Bool("method_interfaces", false, "also generate a single-method client interface with a mock for every method")
+	simpleClients  = flags.Bool("simple_clients", false, "also generate client interfaces without call options, with an adapter and a mock")
+	builders       = flags.Bool("builders", false, "generate fluent builders of the request and response messages of the package")
+	fixtures       = flags.Bool("fixtures", false, "generate helpers loading and saving golden textproto or JSON files of the request and response messages of the package")
+	matchers       = flags.Bool("matchers", false, "generate protocmp matchers of the request and response messages of the package")
+	factories      = flags.Bool("factories", false, "generate seeded factories of fake request and response messages, and the messages they contain")
+	fuzzTargets    = flags.Bool("fuzz_targets", false, "generate fuzz targets feeding requests made by the factories to server implementations")
+	enums          = flags.Bool("enum_aliases", false, "alias the enums of other packages the request and response messages use, and their values, next to the mocks")
+	sharedStreams  = flags.Bool("share_stream_mocks", false, "embed shared grpc.ClientStream and grpc.ServerStream mocks, generated once per package, in the stream mocks")
+	grpcMocks      = flags.String("grpc_mocks", "", "import path of a package of grpc.ClientStream, grpc.ServerStream and grpc.ServerTransportStream mocks to generate, e.g. example.com/mocks/grpcmock")
+	recordSends    = flags.Bool("record_sends", false, "record the messages passed to Send by server stream mocks, for SentMessages and AssertSentInOrder")
+	scriptMD       = flags.Bool("script_metadata", false, "generate ReturnHeader and ReturnTrailer on client stream mocks, scripting the metadata they return")
+	retryHelpers   = flags.Bool("retry_helpers", false, "generate <Method>FailsThenSucceeds helpers on client and server mocks for retry tests")
+	contracts      = flags.Bool("contracts", false, "generate a contract test suite per service, run against clients of the mock and of real servers alike")
+	unimplServers  = flags.Bool("unimplemented_servers", false, "embed Unimplemented<Service>Server in server mocks, and generate Partial<Service>Server filling in the methods of partial implementations")
+	harnesses      = flags.Bool("interceptor_harness", false, "generate Intercept<Service>_<Method> functions running a server interceptor with the server info of the method and a handler calling a server")
+	testSkeletons  = flags.Bool("test_skeletons", false, "also generate a _test.go file of table-driven test skeletons of the unary client methods, wired to their mocks")
+	examples       = flags.Bool("examples", false, "also generate a _test.go file with an Example of the mock of every client")
+	logCalls       = flags.Bool("log_calls", false, "generate LogCalls on mocks, logging every call with its arguments and results to a function such as t.Logf")
+	ifacesOnly     = flags.Bool("interfaces_only", false, "generate the client, server and stream interfaces instead of mocks")
+	mockPrefix     = flags.String("mock_import_prefix", "", "write the mocks of every Go package into mock_<name> at this prefix followed by its import path, e.g. example.com/mocks")
+	mockGoMod      = flags.Bool("mock_go_mod", false, "with mock_import_prefix, also write a go.mod stub declaring the prefix as a module")
+	manifest       = flags.String("manifest", "", "name of a JSON manifest listing every file generated by the invocation, with its Go package and sources")
+	goGenerate     = flags.String("go_generate", "", "write a generate.go with a go:generate directive regenerating the mocks of each package: protoc or buf")
+	genImports     = flags.Bool("generate_imports", true, "generate mocks for files to generate that other files to generate of another Go package import, as buf's include_imports adds them")
+	singleFile     = flags.Bool("single_file", false, "generate one mocks.pb.go per Go package instead of one file per proto file")
+	workers        = flags.Int("workers", runtime.GOMAXPROCS(0), "number of files generated concurrently")
+	hookFiles      hookPaths
 )
 
-func getMethodType(m *protogen.Method) methodType {
-	if !m.Desc.IsStreamingClient() && !m.Desc.IsStreamingServer() {
-		return methodTypeUnary
+func init() {
+	flags.Var(&hookFiles, "hook", "path to a Go plugin exporting "+hookSymbol+"; may be repeated")
+}
+
+// parseGoVersion returns the minor version of a Go 1.x release such as
+// "1.18", "go1.21" or "1.20.3".
+func parseGoVersion(v string) (int, error) {
+	parts := strings.Split(strings.TrimPrefix(v, "go"), ".")
+	if len(parts) < 2 || parts[0] != "1" {
+		return 0, fmt.Errorf("invalid go_version %q, expected a version like 1.18", v)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid go_version %q, expected a version like 1.18", v)
+	}
+	return minor, nil
+}
+
+// pluginVersion reports the module version the plugin binary was built from.
+func pluginVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
 	}
-	if !m.Desc.IsStreamingServer() {
-		return methodTypeClientStream
+	return "(devel)"
+}
+
+func compilerVersion(v *pluginpb.Version) string {
+	if v == nil {
+		return "(unknown)"
 	}
-	if !m.Desc.IsStreamingClient() {
-		return methodTypeServerStream
+	version := fmt.Sprintf("v%d.%d.%d", v.GetMajor(), v.GetMinor(), v.GetPatch())
+	if suffix := v.GetSuffix(); suffix != "" {
+		version += "-" + suffix
 	}
-	return methodTypeBidirectionalStream
+	return version
 }
 
-func fileToModel(file *protogen.File) *model.Package {
-	pkg := &model.Package{
-		Name:    string(file.GoPackageName),
-		PkgPath: string(file.GoImportPath),
+func main() {
+	cmdFlags.Parse(os.Args[1:])
+	if *showVersion {
+		fmt.Printf("protoc-gen-go-grpc-mock %s\n", pluginVersion())
+		return
+	}
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", filepath.Base(os.Args[0]), err)
+		os.Exit(1)
 	}
+}
 
-	for _, s := range file.Services {
-		clientIface := &model.Interface{Name: fmt.Sprintf("%sClient", s.GoName)}
-		serverIface := &model.Interface{Name: fmt.Sprintf("%sServer", s.GoName)}
-		for _, m := range s.Methods {
-			switch getMethodType(m) {
-			case methodTypeUnary:
-				clientMethod, serverMethod := makeUnaryMethods(m)
-				clientIface.AddMethod(clientMethod)
-				serverIface.AddMethod(serverMethod)
-			case methodTypeServerStream:
-				clientMethod, serverMethod, ifaces := makeServerStreamMethods(m)
-				pkg.Interfaces = append(pkg.Interfaces, ifaces...)
-				clientIface.AddMethod(clientMethod)
-				serverIface.AddMethod(serverMethod)
-			case methodTypeClientStream:
-				clientMethod, serverMethod, ifaces := makeClientStreamMethods(m)
-				pkg.Interfaces = append(pkg.Interfaces, ifaces...)
-				clientIface.AddMethod(clientMethod)
-				serverIface.AddMethod(serverMethod)
-			case methodTypeBidirectionalStream:
-				clientMethod, serverMethod, ifaces := makeBidirectionalStreamMethods(m)
-				pkg.Interfaces = append(pkg.Interfaces, ifaces...)
-				clientIface.AddMethod(clientMethod)
-				serverIface.AddMethod(serverMethod)
-			}
+// run reads a CodeGeneratorRequest from stdin, or from the file given with
+// -replay, and writes the response to stdout, or the generated files to the
+// -out directory when replaying.
+func run() error {
+	var in []byte
+	var err error
+	if *replayFile != "" {
+		in, err = os.ReadFile(*replayFile)
+	} else {
+		in, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return err
+	}
+	req := &pluginpb.CodeGeneratorRequest{}
+	if err := proto.Unmarshal(in, req); err != nil {
+		return err
+	}
+
+	if err := expandParams(req); err != nil {
+		return err
+	}
+
+	// The dump is written before the request is handed to protogen, so
+	// requests protogen itself rejects can be captured too.
+	if path := requestParam(req, "debug_request_file"); path != "" {
+		if err := os.WriteFile(path, in, 0o644); err != nil {
+			return fmt.Errorf("failed writing debug request file: %w", err)
 		}
-		pkg.Interfaces = append(pkg.Interfaces, clientIface, serverIface)
 	}
 
-	return pkg
+	if err := applyConfig(req); err != nil {
+		return err
+	}
+	if err := applyProfile(req); err != nil {
+		return err
+	}
+	if err := resolveGoPackages(req); err != nil {
+		return err
+	}
+	plugin, err := protogen.Options{ParamFunc: flags.Set, ImportRewriteFunc: rewriteImport}.New(req)
+	if err != nil {
+		return err
+	}
+	if err := generate(plugin); err != nil {
+		plugin.Error(err)
+	}
+	resp := plugin.Response()
+
+	if *replayFile != "" {
+		return writeResponseFiles(resp, *replayOut, os.Stderr)
+	}
+	out, err := proto.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
 }
 
-func makeUnaryMethods(m *protogen.Method) (*model.Method, *model.Method) {
-	clientMethod := &model.Method{
-		Name: m.GoName,
-		In: []*model.Parameter{
-			{Name: "ctx", Type: &model.NamedType{Package: "context", Type: "Context"}},
-			{Name: "in", Type: &model.PointerType{Type: &model.NamedType{Package: string(m.Input.GoIdent.GoImportPath), Type: m.Input.GoIdent.GoName}}},
-		},
-		Out: []*model.Parameter{
-			{Type: &model.PointerType{Type: &model.NamedType{Package: string(m.Output.GoIdent.GoImportPath), Type: m.Output.GoIdent.GoName}}},
-			{Type: model.PredeclaredType("error")},
-		},
-		Variadic: &model.Parameter{Name: "opts", Type: &model.NamedType{Package: "google.golang.org/grpc", Type: "CallOption"}},
-	}
-	serverMethod := &model.Method{
-		Name: m.GoName,
-		In: []*model.Parameter{
-			{Name: "ctx", Type: &model.NamedType{Package: "context", Type: "Context"}},
-			{Name: "in", Type: &model.PointerType{Type: &model.NamedType{Package: string(m.Input.GoIdent.GoImportPath), Type: m.Input.GoIdent.GoName}}},
-		},
-		Out: []*model.Parameter{
-			{Type: &model.PointerType{Type: &model.NamedType{Package: string(m.Output.GoIdent.GoImportPath), Type: m.Output.GoIdent.GoName}}},
-			{Type: model.PredeclaredType("error")},
-		},
-	}
-	return clientMethod, serverMethod
+// generate adds a mock file for every file protoc asked to generate.
+func generate(plugin *protogen.Plugin) error {
+	plugin.SupportedFeatures = uint64(pluginpb.CodeGeneratorResponse_FEATURE_PROTO3_OPTIONAL)
+
+	switch *formatStyle {
+	case "goimports", "gofumpt":
+	default:
+		return fmt.Errorf("unknown format %q, must be goimports or gofumpt", *formatStyle)
+	}
+	toolsimports.LocalPrefix = *localPrefix
+
+	if _, ok := frameworkTemplates[*framework]; !ok {
+		return fmt.Errorf("unknown framework %q, must be gomock, mockery or minimock", *framework)
+	}
+	if *sharedStreams && *framework != "gomock" {
+		return fmt.Errorf("share_stream_mocks is only supported with framework=gomock")
+	}
+	if *recordSends && *framework != "gomock" {
+		return fmt.Errorf("record_sends is only supported with framework=gomock")
+	}
+	if *scriptMD && *framework != "gomock" {
+		return fmt.Errorf("script_metadata is only supported with framework=gomock")
+	}
+	if *retryHelpers && *framework != "gomock" {
+		return fmt.Errorf("retry_helpers is only supported with framework=gomock")
+	}
+	if *harnesses && *ifacesOnly {
+		return fmt.Errorf("interceptor_harness is not supported with interfaces_only")
+	}
+	if *unimplServers && (*framework != "gomock" || *ifacesOnly) {
+		return fmt.Errorf("unimplemented_servers is only supported with framework=gomock, without interfaces_only")
+	}
+	if *logCalls && *framework != "gomock" {
+		return fmt.Errorf("log_calls is only supported with framework=gomock")
+	}
+
+	// Default to the oldest release the generated code has always
+	// supported, before type parameters and the any alias.
+	goMinor := 17
+	if *goVersion != "" {
+		minor, err := parseGoVersion(*goVersion)
+		if err != nil {
+			return err
+		}
+		goMinor = minor
+	}
+
+	switch *grpcAPI {
+	case "", "v1.58":
+	case "v1.64", "latest":
+		if *goVersion != "" && goMinor < 18 {
+			return fmt.Errorf("grpc_api=%s needs go_version 1.18 or later for its generic stream types", *grpcAPI)
+		}
+	default:
+		return fmt.Errorf("unknown grpc_api %q, must be v1.58, v1.64 or latest", *grpcAPI)
+	}
+
+	if *fuzzTargets {
+		if !*factories {
+			return fmt.Errorf("fuzz_targets requires factories")
+		}
+		if *goVersion != "" && goMinor < 18 {
+			return fmt.Errorf("fuzz_targets needs go_version 1.18 or later for testing.F")
+		}
+	}
+
+	if *testSkeletons && (*framework != "gomock" || *ifacesOnly) {
+		return fmt.Errorf("test_skeletons is only supported with framework=gomock, without interfaces_only")
+	}
+	if *examples && (*framework != "gomock" || *ifacesOnly) {
+		return fmt.Errorf("examples is only supported with framework=gomock, without interfaces_only")
+	}
+
+	switch *goGenerate {
+	case "", "protoc", "buf":
+	default:
+		return fmt.Errorf("unknown go_generate %q, must be protoc or buf", *goGenerate)
+	}
+
+	if *grpcMocks != "" {
+		if *ifacesOnly {
+			return fmt.Errorf("grpc_mocks is not supported with interfaces_only")
+		}
+		if !token.IsIdentifier(path.Base(*grpcMocks)) {
+			return fmt.Errorf("grpc_mocks %q must end in a valid package name", *grpcMocks)
+		}
+	}
+
+	if *mockGoMod && *mockPrefix == "" {
+		return fmt.Errorf("mock_go_mod requires mock_import_prefix")
+	}
+	if *mockPrefix == "" {
+		for _, o := range testOnlyOptions {
+			if flags.Lookup(o.name).Value.String() == "true" {
+				return fmt.Errorf("%s requires mock_import_prefix, as its helpers import %s", o.name, o.imports)
+			}
+		}
+	}
+
+	templates, err := loadTemplates(*templatesDir)
+	if err != nil {
+		return fmt.Errorf("failed loading templates: %w", err)
+	}
+
+	if *workers < 1 {
+		return fmt.Errorf("workers must be at least 1, got %d", *workers)
+	}
+
+	switch *dumpModel {
+	case "", "false", "true", "only":
+	default:
+		return fmt.Errorf("unknown dump_model %q, must be true, false or only", *dumpModel)
+	}
+
+	hooks, err := loadHooks(hookFiles)
+	if err != nil {
+		return err
+	}
+
+	var copyrightHeader string
+	if *copyrightFile != "" {
+		header, err := os.ReadFile(*copyrightFile)
+		if err != nil {
+			return fmt.Errorf("failed reading copyright file: %w", err)
+		}
+		copyrightHeader = strings.TrimSpace(string(header))
+	}
+
+	diags := new(diagnostics)
+	for _, option := range profileDropped {
+		diags.warnAt("profile="+flags.Lookup("profile").Value.String(), "%s is left out, as it requires mock_import_prefix", option)
+	}
+	mocks, err := applyOverrides(plugin.Files, diags)
+	if err != nil {
+		return err
+	}
+
+	units := outputUnits(plugin.Files)
+	opts := fileOptions{
+		out:             &output{plugin: plugin, dryRun: *dryRun},
+		templates:       templates,
+		hooks:           hooks,
+		hookMu:          new(sync.Mutex),
+		goMinor:         goMinor,
+		compilerVersion: compilerVersion(plugin.Request.GetCompilerVersion()),
+		copyrightHeader: copyrightHeader,
+		mocks:           mocks,
+	}
+	if *builders {
+		opts.builderOwners = messageOwners(units, false)
+	}
+	if *fixtures {
+		opts.fixtureOwners = messageOwners(units, false)
+	}
+	if *matchers {
+		opts.matcherOwners = messageOwners(units, false)
+	}
+	if *factories {
+		opts.factoryOwners = messageOwners(units, true)
+	}
+
+	declared := declaredGoNames(plugin.Files)
+	if *enums {
+		opts.enumAliases = enumAliases(units, declared)
+	}
+	if *examples {
+		opts.exampleHosts = exampleHosts(units)
+	}
+
+	// Files are generated concurrently into per-file buffers, which are then
+	// added to the response in request order to keep the output stable.
+	type fileResult struct {
+		out   *fileOutput
+		diags *diagnostics
+	}
+	results := make([]*fileResult, len(units))
+	var eg errgroup.Group
+	eg.SetLimit(*workers)
+	for i, files := range units {
+		i, files := i, files
+		eg.Go(func() error {
+			res := &fileResult{out: &fileOutput{files: files}, diags: new(diagnostics)}
+			if err := generateFile(res.out, opts, res.diags, declared); err != nil {
+				res.diags.errorf(files[0].Desc, "%v", err)
+			}
+			results[i] = res
+			return nil
+		})
+	}
+	_ = eg.Wait()
+
+	if *sharedStreams && !*ifacesOnly {
+		for _, files := range streamPackages(units) {
+			res := &fileResult{out: &fileOutput{files: files}, diags: new(diagnostics)}
+			if err := generateStreamMocks(res.out, opts); err != nil {
+				res.diags.errorf(files[0].Desc, "%v", err)
+			}
+			results = append(results, res)
+		}
+	}
+
+	if *grpcMocks != "" && len(units) > 0 {
+		res := &fileResult{out: &fileOutput{files: units[0], importPath: protogen.GoImportPath(*grpcMocks)}, diags: new(diagnostics)}
+		if err := generateGRPCMocks(res.out, opts); err != nil {
+			res.diags.errorf(units[0][0].Desc, "%v", err)
+		}
+		results = append(results, res)
+	}
+
+	if *goGenerate != "" {
+		for _, files := range mockPackages(units) {
+			res := &fileResult{out: &fileOutput{files: files}, diags: new(diagnostics)}
+			if err := generateDirective(res.out, opts, givenParam); err != nil {
+				res.diags.errorf(files[0].Desc, "%v", err)
+			}
+			results = append(results, res)
+		}
+	}
+
+	if *mockGoMod && len(units) > 0 {
+		res := &fileResult{out: &fileOutput{files: units[0]}, diags: new(diagnostics)}
+		res.out.write(path.Join(*mockPrefix, "go.mod"), opts.goModStub(), "go.mod stub", nil)
+		results = append(results, res)
+	}
+
+	out := opts.out
+	for _, res := range results {
+		diags.list = append(diags.list, res.diags.list...)
+		if err := out.flush(res.out); err != nil {
+			diags.errorf(res.out.files[0].Desc, "%v", err)
+		}
+	}
+	if *manifest != "" && !*dryRun {
+		if err := out.writeManifest(*manifest, moduleParam(plugin.Request.GetParameter())); err != nil {
+			return err
+		}
+	}
+	diags.writeWarnings(os.Stderr)
+	if *dryRun {
+		out.writeReport(os.Stderr, diags)
+	}
+	return diags.err()
 }
 
-func makeServerStreamMethods(m *protogen.Method) (*model.Method, *model.Method, []*model.Interface) {
-	clientIfaceName := fmt.Sprintf("%s_%sClient", m.Parent.GoName, m.GoName)
-	serverIfaceName := fmt.Sprintf("%s_%sServer", m.Parent.GoName, m.GoName)
-	clientMethod := &model.Method{
-		Name: m.GoName,
-		In: []*model.Parameter{
-			{Name: "ctx", Type: &model.NamedType{Package: "context", Type: "Context"}},
-			{Name: "in", Type: &model.PointerType{Type: &model.NamedType{Package: string(m.Input.GoIdent.GoImportPath), Type: m.Input.GoIdent.GoName}}},
-		},
-		Out: []*model.Parameter{
-			{Type: &model.NamedType{Type: clientIfaceName}},
-			{Type: model.PredeclaredType("error")},
-		},
-		Variadic: &model.Parameter{Name: "opts", Type: &model.NamedType{Package: "google.golang.org/grpc", Type: "CallOption"}},
-	}
-	serverMethod := &model.Method{
-		Name: m.GoName,
-		In: []*model.Parameter{
-			{Name: "blob", Type: &model.PointerType{Type: &model.NamedType{Package: string(m.Input.GoIdent.GoImportPath), Type: m.Input.GoIdent.GoName}}},
-			{Name: "server", Type: &model.NamedType{Type: serverIfaceName}},
-		},
-		Out: []*model.Parameter{
-			{Type: model.PredeclaredType("error")},
-		},
-	}
-	clientIface := &model.Interface{
-		Name:    clientIfaceName,
-		Methods: baseClientStreamMethods(),
-	}
-	clientIface.AddMethod(&model.Method{
-		Name: "Recv",
-		Out: []*model.Parameter{
-			{Type: &model.PointerType{Type: &model.NamedType{Package: string(m.Output.GoIdent.GoImportPath), Type: m.Output.GoIdent.GoName}}},
-			{Type: model.PredeclaredType("error")},
-		},
-	})
-	serverIface := &model.Interface{
-		Name:    serverIfaceName,
-		Methods: baseServerStreamMethods(),
-	}
-	serverIface.AddMethod(&model.Method{
-		Name: "Send",
-		In: []*model.Parameter{
-			{Type: &model.PointerType{Type: &model.NamedType{Package: string(m.Output.GoIdent.GoImportPath), Type: m.Output.GoIdent.GoName}}},
-		},
-		Out: []*model.Parameter{
-			{Type: model.PredeclaredType("error")},
-		},
-	})
+// newGenerator returns a generator for the file name with the options shared
+// by all files.
+func (opts fileOptions) newGenerator(name string, importPath protogen.GoImportPath) *generator {
+	g := new(generator)
+	g.gf = opts.out.scratchFile(name, importPath)
+	g.templates = opts.templates
+	g.gofumpt = *formatStyle == "gofumpt"
+	g.goMinor = opts.goMinor
+	g.useAny = opts.goMinor >= 18
+	if !*omitVersion {
+		g.versions = [][2]string{
+			{"protoc-gen-go-grpc-mock", pluginVersion()},
+			{"protoc", opts.compilerVersion},
+		}
+	}
+	g.copyrightHeader = opts.copyrightHeader
+	g.overrides = opts.mocks[importPath]
+	g.buildConstraints = *buildTags
+	return g
+}
 
-	return clientMethod, serverMethod, []*model.Interface{clientIface, serverIface}
+// fileOptions holds the parameters shared by all files of a request.
+type fileOptions struct {
+	out             *output
+	templates       *template.Template
+	hooks           []hookFunc
+	hookMu          *sync.Mutex // hooks are not required to be safe for concurrent use
+	goMinor         int
+	compilerVersion string
+	copyrightHeader string
+	mocks           map[protogen.GoImportPath]map[string]mockOverride // set by the config file, see applyOverrides
+	builderOwners   map[protogen.GoIdent]*protogen.File               // nil without builders
+	fixtureOwners   map[protogen.GoIdent]*protogen.File               // nil without fixtures
+	matcherOwners   map[protogen.GoIdent]*protogen.File               // nil without matchers
+	factoryOwners   map[protogen.GoIdent]*protogen.File               // nil without factories
+	enumAliases     map[*protogen.File][]*protogen.Enum               // nil without enum_aliases
+	exampleHosts    map[*protogen.File]bool                           // nil without examples
 }
 
-func makeClientStreamMethods(m *protogen.Method) (*model.Method, *model.Method, []*model.Interface) {
-	clientIfaceName := fmt.Sprintf("%s_%sClient", m.Parent.GoName, m.GoName)
-	serverIfaceName := fmt.Sprintf("%s_%sServer", m.Parent.GoName, m.GoName)
-	clientMethod := &model.Method{
-		Name: m.GoName,
-		In: []*model.Parameter{
-			{Name: "ctx", Type: &model.NamedType{Package: "context", Type: "Context"}},
-		},
-		Out: []*model.Parameter{
-			{Type: &model.NamedType{Type: clientIfaceName}},
-			{Type: model.PredeclaredType("error")},
-		},
-		Variadic: &model.Parameter{Name: "opts", Type: &model.NamedType{Package: "google.golang.org/grpc", Type: "CallOption"}},
-	}
-	serverMethod := &model.Method{
-		Name: m.GoName,
-		In: []*model.Parameter{
-			{Name: "server", Type: &model.NamedType{Type: serverIfaceName}},
-		},
-		Out: []*model.Parameter{
-			{Type: model.PredeclaredType("error")},
-		},
-	}
-	clientIface := &model.Interface{
-		Name:    clientIfaceName,
-		Methods: baseClientStreamMethods(),
-	}
-	clientIface.AddMethod(&model.Method{
-		Name: "Send",
-		In: []*model.Parameter{
-			{Type: &model.PointerType{Type: &model.NamedType{Package: string(m.Input.GoIdent.GoImportPath), Type: m.Input.GoIdent.GoName}}},
-		},
-		Out: []*model.Parameter{
-			{Type: model.PredeclaredType("error")},
-		},
-	})
-	clientIface.AddMethod(&model.Method{
-		Name: "CloseAndRecv",
-		Out: []*model.Parameter{
-			{Type: &model.PointerType{Type: &model.NamedType{Package: string(m.Output.GoIdent.GoImportPath), Type: m.Output.GoIdent.GoName}}},
-			{Type: model.PredeclaredType("error")},
-		},
-	})
-	serverIface := &model.Interface{
-		Name:    serverIfaceName,
-		Methods: baseServerStreamMethods(),
-	}
-	serverIface.AddMethod(&model.Method{
-		Name: "SendAndClose",
-		In: []*model.Parameter{
-			{Type: &model.PointerType{Type: &model.NamedType{Package: string(m.Input.GoIdent.GoImportPath), Type: m.Input.GoIdent.GoName}}},
-		},
-		Out: []*model.Parameter{
-			{Type: model.PredeclaredType("error")},
-		},
-	})
-	serverIface.AddMethod(&model.Method{
-		Name: "Recv",
-		Out: []*model.Parameter{
-			{Type: &model.PointerType{Type: &model.NamedType{Package: string(m.Output.GoIdent.GoImportPath), Type: m.Output.GoIdent.GoName}}},
-			{Type: model.PredeclaredType("error")},
-		},
-	})
+// mockPackage is the Go package the mocks of a proto file are written to.
+type mockPackage struct {
+	importPath protogen.GoImportPath
+	name       protogen.GoPackageName
+	dir        string // output directory
+}
 
-	return clientMethod, serverMethod, []*model.Interface{clientIface, serverIface}
+// mockPackageOf returns the package the mocks of file are written to, which is
+// the package of file itself unless mock_import_prefix is set.
+func mockPackageOf(file *protogen.File) mockPackage {
+	if *mockPrefix == "" {
+		return mockPackage{file.GoImportPath, file.GoPackageName, path.Dir(file.GeneratedFilenamePrefix)}
+	}
+	importPath := path.Join(*mockPrefix, string(file.GoImportPath))
+	return mockPackage{
+		importPath: protogen.GoImportPath(importPath),
+		name:       "mock_" + file.GoPackageName,
+		dir:        importPath,
+	}
 }
 
-func makeBidirectionalStreamMethods(m *protogen.Method) (*model.Method, *model.Method, []*model.Interface) {
-	clientIfaceName := fmt.Sprintf("%s_%sClient", m.Parent.GoName, m.GoName)
-	serverIfaceName := fmt.Sprintf("%s_%sServer", m.Parent.GoName, m.GoName)
-	clientMethod := &model.Method{
-		Name: m.GoName,
-		In: []*model.Parameter{
-			{Name: "ctx", Type: &model.NamedType{Package: "context", Type: "Context"}},
-		},
-		Out: []*model.Parameter{
-			{Type: &model.NamedType{Type: clientIfaceName}},
-			{Type: model.PredeclaredType("error")},
-		},
-		Variadic: &model.Parameter{Name: "opts", Type: &model.NamedType{Package: "google.golang.org/grpc", Type: "CallOption"}},
-	}
-	serverMethod := &model.Method{
-		Name: m.GoName,
-		In: []*model.Parameter{
-			{Name: "server", Type: &model.NamedType{Type: serverIfaceName}},
-		},
-		Out: []*model.Parameter{
-			{Type: model.PredeclaredType("error")},
-		},
-	}
-	clientIface := &model.Interface{
-		Name:    clientIfaceName,
-		Methods: baseClientStreamMethods(),
-	}
-	clientIface.AddMethod(&model.Method{
-		Name: "Send",
-		In: []*model.Parameter{
-			{Type: &model.PointerType{Type: &model.NamedType{Package: string(m.Input.GoIdent.GoImportPath), Type: m.Input.GoIdent.GoName}}},
-		},
-		Out: []*model.Parameter{
-			{Type: model.PredeclaredType("error")},
-		},
-	})
-	clientIface.AddMethod(&model.Method{
-		Name: "Recv",
-		Out: []*model.Parameter{
-			{Type: &model.PointerType{Type: &model.NamedType{Package: string(m.Output.GoIdent.GoImportPath), Type: m.Output.GoIdent.GoName}}},
-			{Type: model.PredeclaredType("error")},
-		},
-	})
-	serverIface := &model.Interface{
-		Name:    serverIfaceName,
-		Methods: baseServerStreamMethods(),
-	}
-	serverIface.AddMethod(&model.Method{
-		Name: "Send",
-		In: []*model.Parameter{
-			{Type: &model.PointerType{Type: &model.NamedType{Package: string(m.Input.GoIdent.GoImportPath), Type: m.Input.GoIdent.GoName}}},
-		},
-		Out: []*model.Parameter{
-			{Type: model.PredeclaredType("error")},
-		},
-	})
-	serverIface.AddMethod(&model.Method{
-		Name: "Recv",
-		Out: []*model.Parameter{
-			{Type: &model.PointerType{Type: &model.NamedType{Package: string(m.Output.GoIdent.GoImportPath), Type: m.Output.GoIdent.GoName}}},
-			{Type: model.PredeclaredType("error")},
-		},
-	})
+// goModStub returns a go.mod declaring the mock_import_prefix module.
+func (o fileOptions) goModStub() []byte {
+	minor := o.goMinor
+	if minor < 17 {
+		minor = 17
+	}
+	return []byte(fmt.Sprintf("module %s\n\ngo 1.%d\n", *mockPrefix, minor))
+}
 
-	return clientMethod, serverMethod, []*model.Interface{clientIface, serverIface}
+// runHooks applies the hooks to pkg one file at a time.
+func (o fileOptions) runHooks(file *protogen.File, pkg *grpcmodel.Package) error {
+	if len(o.hooks) == 0 {
+		return nil
+	}
+	o.hookMu.Lock()
+	defer o.hookMu.Unlock()
+	for _, hook := range o.hooks {
+		if err := hook(file, pkg); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func baseClientStreamMethods() []*model.Method {
-	return []*model.Method{
-		{
-			Name: "Header",
-			Out: []*model.Parameter{
-				{Type: &model.NamedType{Package: "google.golang.org/grpc/metadata", Type: "MD"}},
-				{Type: model.PredeclaredType("error")},
-			},
-		},
-		{
-			Name: "Trailer",
-			Out: []*model.Parameter{
-				{Type: &model.NamedType{Package: "google.golang.org/grpc/metadata", Type: "MD"}},
-			},
-		},
-		{
-			Name: "CloseSend",
-			Out: []*model.Parameter{
-				{Type: model.PredeclaredType("error")},
-			},
-		},
-		{
-			Name: "Context",
-			Out: []*model.Parameter{
-				{Type: &model.NamedType{Package: "context", Type: "Context"}},
-			},
-		},
-		{
-			Name: "SendMsg",
-			In: []*model.Parameter{
-				{Name: "arg0", Type: model.PredeclaredType("interface{}")},
-			},
-			Out: []*model.Parameter{
-				{Type: model.PredeclaredType("error")},
-			},
-		},
-		{
-			Name: "RecvMsg",
-			In: []*model.Parameter{
-				{Name: "arg0", Type: model.PredeclaredType("interface{}")},
-			},
-			Out: []*model.Parameter{
-				{Type: model.PredeclaredType("error")},
-			},
-		},
+// outputUnits groups the files to generate by the Go file their mocks are
+// written to: one group per file, or one per Go package with single_file.
+func outputUnits(files []*protogen.File) [][]*protogen.File {
+	var imported map[string]bool
+	if !*genImports {
+		imported = importedFiles(files)
+	}
+	var units [][]*protogen.File
+	byPackage := make(map[protogen.GoImportPath]int)
+	for _, file := range files {
+		if !file.Generate || imported[file.Desc.Path()] {
+			continue
+		}
+		if *singleFile {
+			if i, ok := byPackage[file.GoImportPath]; ok {
+				units[i] = append(units[i], file)
+				continue
+			}
+			byPackage[file.GoImportPath] = len(units)
+		}
+		units = append(units, []*protogen.File{file})
 	}
+	return units
 }
 
-func baseServerStreamMethods() []*model.Method {
-	return []*model.Method{
-		{
-			Name: "SetHeader",
-			In: []*model.Parameter{
-				{Type: &model.NamedType{Package: "google.golang.org/grpc/metadata", Type: "MD"}},
-			},
-			Out: []*model.Parameter{
-				{Type: model.PredeclaredType("error")},
-			},
-		},
-		{
-			Name: "SendHeader",
-			In: []*model.Parameter{
-				{Type: &model.NamedType{Package: "google.golang.org/grpc/metadata", Type: "MD"}},
-			},
-			Out: []*model.Parameter{
-				{Type: model.PredeclaredType("error")},
-			},
-		},
-		{
-			Name: "SetTrailer",
-			In: []*model.Parameter{
-				{Type: &model.NamedType{Package: "google.golang.org/grpc/metadata", Type: "MD"}},
-			},
-		},
-		{
-			Name: "Context",
-			Out: []*model.Parameter{
-				{Type: &model.NamedType{Package: "context", Type: "Context"}},
-			},
-		},
-		{
-			Name: "SendMsg",
-			In: []*model.Parameter{
-				{Name: "arg0", Type: model.PredeclaredType("interface{}")},
-			},
-			Out: []*model.Parameter{
-				{Type: model.PredeclaredType("error")},
-			},
-		},
-		{
-			Name: "RecvMsg",
-			In: []*model.Parameter{
-				{Name: "arg0", Type: model.PredeclaredType("interface{}")},
-			},
-			Out: []*model.Parameter{
-				{Type: model.PredeclaredType("error")},
-			},
-		},
+// importedFiles returns the paths of the files to generate that are imported,
+// directly or not, by a file to generate of another Go package. Those are the
+// files include_imports adds to a request, as opposed to the files it was
+// made for.
+func importedFiles(files []*protogen.File) map[string]bool {
+	byPath := make(map[string]*protogen.File, len(files))
+	for _, file := range files {
+		byPath[file.Desc.Path()] = file
+	}
+	imported := make(map[string]bool)
+	for _, file := range files {
+		if !file.Generate {
+			continue
+		}
+		seen := make(map[string]bool)
+		var visit func(fd protoreflect.FileDescriptor)
+		visit = func(fd protoreflect.FileDescriptor) {
+			imports := fd.Imports()
+			for i := 0; i < imports.Len(); i++ {
+				dep, ok := byPath[imports.Get(i).Path()]
+				if !ok || seen[dep.Desc.Path()] {
+					continue
+				}
+				seen[dep.Desc.Path()] = true
+				if dep.Generate && dep.GoImportPath != file.GoImportPath {
+					imported[dep.Desc.Path()] = true
+				}
+				visit(dep.Desc)
+			}
+		}
+		visit(file.Desc)
 	}
+	return imported
 }
 
-func main() {
-	protogen.Options{}.Run(func(plugin *protogen.Plugin) error {
-		plugin.SupportedFeatures = uint64(pluginpb.CodeGeneratorResponse_FEATURE_PROTO3_OPTIONAL)
-		for path, file := range plugin.FilesByPath {
-			if !file.Generate {
+// streamPackages groups the files of units by Go package, keeping only the
+// packages with streaming methods.
+func streamPackages(units [][]*protogen.File) [][]*protogen.File {
+	var packages [][]*protogen.File
+	byPackage := make(map[protogen.GoImportPath]int)
+	for _, files := range units {
+		for _, file := range files {
+			if !hasStreams(file) {
 				continue
 			}
-			pkg := fileToModel(file)
-			if len(pkg.Interfaces) == 0 {
+			if i, ok := byPackage[file.GoImportPath]; ok {
+				packages[i] = append(packages[i], file)
 				continue
 			}
+			byPackage[file.GoImportPath] = len(packages)
+			packages = append(packages, []*protogen.File{file})
+		}
+	}
+	return packages
+}
+
+func hasStreams(file *protogen.File) bool {
+	for _, s := range file.Services {
+		for _, m := range s.Methods {
+			if grpcmodel.MethodTypeOf(m) != grpcmodel.MethodTypeUnary {
+				return true
+			}
+		}
+	}
+	return false
+}
 
-			g := new(generator)
-			g.filename = path
+// generateStreamMocks generates the grpc.ClientStream and grpc.ServerStream
+// mocks shared by the stream mocks of the Go package of out. The file has
+// the same content for every proto file of the package, so it may be
+// generated by several protoc invocations.
+func generateStreamMocks(out *fileOutput, opts fileOptions) error {
+	mp := mockPackageOf(out.files[0])
+	name := path.Join(mp.dir, "grpc_mock_streams.pb.go")
+	g := opts.newGenerator(name, mp.importPath)
+	if err := g.GenerateStreamMocks(string(mp.name)); err != nil {
+		return err
+	}
+	src, err := g.gf.Content()
+	if err != nil {
+		return err
+	}
+	if src, err = g.format(src); err != nil {
+		return err
+	}
+	out.write(name, src, "shared stream mocks", nil)
+	return nil
+}
 
-			if err := g.Generate(pkg, string(file.GoPackageName), string(file.GoImportPath)); err != nil {
-				return err
+// generateGRPCMocks generates the package of grpc stream mocks at the
+// grpc_mocks import path.
+func generateGRPCMocks(out *fileOutput, opts fileOptions) error {
+	name := path.Join(*grpcMocks, "grpc_mock.pb.go")
+	g := opts.newGenerator(name, protogen.GoImportPath(*grpcMocks))
+	g.source = "google.golang.org/grpc"
+	if err := g.GenerateGRPCMocks(path.Base(*grpcMocks)); err != nil {
+		return err
+	}
+	src, err := g.gf.Content()
+	if err != nil {
+		return err
+	}
+	if src, err = g.format(src); err != nil {
+		return err
+	}
+	out.write(name, src, "grpc stream mocks", nil)
+	return nil
+}
+
+// generateFile generates the mock file for the proto files of out.
+// Problems that are specific to a service or method are reported to diags
+// instead of being returned. It is called concurrently for different files.
+func generateFile(out *fileOutput, opts fileOptions, diags *diagnostics, declared map[protogen.GoImportPath]map[string]protoreflect.Descriptor) error {
+	first := out.files[0]
+	pkg := &grpcmodel.Package{
+		Name:    string(first.GoPackageName),
+		PkgPath: string(first.GoImportPath),
+	}
+	elements := make(map[string]sourceElement)
+	comments := make(map[string]string)
+	deprecated := make(map[string]bool)
+	derived := make(map[string]derivedInterface)
+	streamBases := make(map[string]string)
+	sent := make(map[string]protogen.GoIdent)
+	scripted := make(map[string]bool)
+	retried := make(map[string]bool)
+	var messages, goldens, matched, fakes []*protogen.Message
+	var aliased []*protogen.Enum
+	var sources []string
+	for _, file := range out.files {
+		filePkg := grpcmodel.FileToModel(file)
+		if *sharedStreams {
+			for _, s := range file.Services {
+				for _, m := range s.Methods {
+					if grpcmodel.MethodTypeOf(m) != grpcmodel.MethodTypeUnary {
+						streamBases[grpcmodel.StreamClientInterfaceName(m)] = baseClientStreamMock
+						streamBases[grpcmodel.StreamServerInterfaceName(m)] = baseServerStreamMock
+					}
+				}
+			}
+		}
+		if *recordSends {
+			for _, s := range file.Services {
+				for _, m := range s.Methods {
+					switch grpcmodel.MethodTypeOf(m) {
+					case grpcmodel.MethodTypeServerStream, grpcmodel.MethodTypeBidirectionalStream:
+						sent[grpcmodel.StreamServerInterfaceName(m)] = m.Output.GoIdent
+					}
+				}
+			}
+		}
+		if *scriptMD {
+			for _, s := range file.Services {
+				for _, m := range s.Methods {
+					if grpcmodel.MethodTypeOf(m) != grpcmodel.MethodTypeUnary {
+						scripted[grpcmodel.StreamClientInterfaceName(m)] = true
+					}
+				}
+			}
+		}
+		if *retryHelpers {
+			for _, s := range file.Services {
+				retried[grpcmodel.ClientInterfaceName(s)] = true
+				retried[grpcmodel.ServerInterfaceName(s)] = true
+			}
+		}
+		if *methodIfaces {
+			filePkg.Interfaces = append(filePkg.Interfaces, grpcmodel.MethodInterfaces(file)...)
+			for _, s := range file.Services {
+				for _, m := range s.Methods {
+					derived[grpcmodel.MethodInterfaceName(m)] = derivedInterface{grpcmodel.ClientInterfaceName(s), "interface"}
+				}
+			}
+		}
+		if *simpleClients {
+			filePkg.Interfaces = append(filePkg.Interfaces, grpcmodel.SimpleClientInterfaces(file)...)
+			for _, s := range file.Services {
+				derived[grpcmodel.SimpleClientInterfaceName(s)] = derivedInterface{grpcmodel.ClientInterfaceName(s), "simple_client"}
 			}
-			if _, err := plugin.NewGeneratedFile(
-				file.GeneratedFilenamePrefix+"_grpc_mock.pb.go",
-				file.GoImportPath,
-			).Write(g.Output()); err != nil {
+		}
+		if *grpcAPI == "v1.64" || *grpcAPI == "latest" {
+			grpcmodel.GenericStreams(file, filePkg)
+		}
+		filePkg.Interfaces = withoutOmitted(filePkg.Interfaces, sourceElements(file))
+		if err := opts.runHooks(file, filePkg); err != nil {
+			return fmt.Errorf("hook: %w", err)
+		}
+		if len(filePkg.Interfaces) == 0 {
+			continue
+		}
+
+		// Without mocks, the interfaces themselves are the generated names.
+		mocks := &generator{overrides: opts.mocks[mockPackageOf(file).importPath]}
+		if *ifacesOnly {
+			mocks = nil
+		}
+		reported := len(diags.list)
+		checkFile(diags, file, filePkg, declared, mocks, helperNames(file, opts))
+		checkFactories(diags, ownedMessages(file, opts.factoryOwners, true), opts.factoryOwners)
+		checkSetterNames(diags, ownedMessages(file, opts.builderOwners, false), false)
+		checkSetterNames(diags, ownedMessages(file, opts.matcherOwners, false), true)
+		for _, d := range diags.list[reported:] {
+			if d.severity == severityError {
+				out.skip("errors")
+				return nil
+			}
+		}
+
+		if *dumpModel == "true" || *dumpModel == "only" {
+			data, err := grpcmodel.MarshalJSON(file.Desc.Path(), filePkg)
+			if err != nil {
 				return err
 			}
+			out.write(path.Join(mockPackageOf(file).dir, path.Base(file.GeneratedFilenamePrefix)+"_grpc_mock.json"), data, "interface model", nil)
+		}
+
+		pkg.Interfaces = append(pkg.Interfaces, filePkg.Interfaces...)
+		messages = append(messages, ownedMessages(file, opts.builderOwners, false)...)
+		goldens = append(goldens, ownedMessages(file, opts.fixtureOwners, false)...)
+		matched = append(matched, ownedMessages(file, opts.matcherOwners, false)...)
+		fakes = append(fakes, ownedMessages(file, opts.factoryOwners, true)...)
+		aliased = append(aliased, opts.enumAliases[file]...)
+		sources = append(sources, file.Desc.Path())
+		for key, e := range sourceElements(file) {
+			elements[key] = e
+			if e.deprecated {
+				deprecated[key] = true
+			}
 		}
+		for key, c := range fileComments(file) {
+			comments[key] = c
+		}
+	}
+	if len(pkg.Interfaces) == 0 {
+		out.skip("no services")
 		return nil
+	}
+	if *dumpModel == "only" {
+		return nil
+	}
+	sort.Slice(pkg.Interfaces, func(i, j int) bool {
+		return pkg.Interfaces[i].Name < pkg.Interfaces[j].Name
 	})
+
+	mp := mockPackageOf(first)
+	base := path.Base(first.GeneratedFilenamePrefix)
+	name := path.Join(mp.dir, base+"_grpc_mock.pb.go")
+	if *singleFile {
+		name = path.Join(mp.dir, "mocks.pb.go")
+	}
+	summary := "%d mocks"
+	if *ifacesOnly {
+		name = path.Join(mp.dir, base+"_grpc_iface.pb.go")
+		if *singleFile {
+			name = path.Join(mp.dir, "interfaces.pb.go")
+		}
+		summary = "%d interfaces"
+	}
+	g := opts.newGenerator(name, mp.importPath)
+	g.source = first.GoImportPath
+	if *ifacesOnly {
+		g.source = mp.importPath // the interfaces are declared next to each other
+	}
+	g.ifacesOnly = *ifacesOnly
+	g.logCalls = *logCalls
+	symbolName := g.mockName
+	if g.ifacesOnly {
+		symbolName = func(intf string) string { return intf }
+	}
+	g.derived = derived
+	g.streamBases = streamBases
+	g.sent = sent
+	g.scripted = scripted
+	g.retried = retried
+	if *contracts {
+		for _, file := range out.files {
+			for _, s := range file.Services {
+				if !*skipDeprecated || !deprecated[grpcmodel.ClientInterfaceName(s)] {
+					g.contracts = append(g.contracts, s)
+				}
+			}
+		}
+	}
+	if *harnesses {
+		for _, file := range out.files {
+			for _, s := range file.Services {
+				if !*skipDeprecated || !deprecated[grpcmodel.ClientInterfaceName(s)] {
+					g.harnesses = append(g.harnesses, s)
+				}
+			}
+		}
+	}
+	if *unimplServers {
+		for _, file := range out.files {
+			g.unimplemented = append(g.unimplemented, file.Services...)
+		}
+	}
+	g.builders = messages
+	g.fixtures = goldens
+	g.matchers = matched
+	g.factories = fakes
+	g.factoryOwners = opts.factoryOwners
+	g.enums = aliased
+	if !*omitSource {
+		g.filename = strings.Join(sources, ", ")
+	}
+	if *copyComments {
+		g.comments = comments
+	}
+	g.deprecated = deprecated
+
+	if g.source != mp.importPath {
+		grpcmodel.Qualify(pkg, string(g.source))
+	}
+	if err := g.Generate(pkg, string(mp.name)); err != nil {
+		return err
+	}
+	src, err := g.gf.Content()
+	if err != nil {
+		return err
+	}
+	if src, err = g.format(src); err != nil {
+		return err
+	}
+	out.write(name, src, fmt.Sprintf(summary, len(pkg.Interfaces)), func(gf *protogen.GeneratedFile) {
+		annotateMocks(gf, pkg, elements, symbolName)
+	})
+	if *testSkeletons {
+		if err := generateTestSkeletons(out, opts, pkg, strings.TrimSuffix(name, ".pb.go")+"_skeleton_test.go"); err != nil {
+			return err
+		}
+	}
+	if *fuzzTargets {
+		var fuzzed []*protogen.Service
+		for _, file := range out.files {
+			for _, s := range file.Services {
+				if !*skipDeprecated || !deprecated[grpcmodel.ClientInterfaceName(s)] {
+					fuzzed = append(fuzzed, s)
+				}
+			}
+		}
+		if err := generateFuzzTargets(out, opts, fuzzed, strings.TrimSuffix(name, ".pb.go")+"_fuzz_test.go"); err != nil {
+			return err
+		}
+	}
+	if *examples {
+		return generateExamples(out, opts, pkg, strings.TrimSuffix(name, ".pb.go")+"_example_test.go")
+	}
+	return nil
+}
+
+// mockedServices returns the services of out whose client mocks are in pkg.
+func mockedServices(out *fileOutput, pkg *grpcmodel.Package) []*protogen.Service {
+	mocked := make(map[string]bool, len(pkg.Interfaces))
+	for _, intf := range pkg.Interfaces {
+		mocked[intf.Name] = true
+	}
+	var services []*protogen.Service
+	for _, file := range out.files {
+		for _, s := range file.Services {
+			if mocked[grpcmodel.ClientInterfaceName(s)] {
+				services = append(services, s)
+			}
+		}
+	}
+	return services
+}
+
+// generateTestSkeletons generates the test skeletons of the services of out
+// whose client mocks are in pkg into the file name.
+func generateTestSkeletons(out *fileOutput, opts fileOptions, pkg *grpcmodel.Package, name string) error {
+	services := mockedServices(out, pkg)
+	if len(services) == 0 {
+		return nil
+	}
+	mp := mockPackageOf(out.files[0])
+	g := opts.newGenerator(name, mp.importPath)
+	if err := g.GenerateTestSkeletons(services, string(mp.name)); err != nil {
+		return err
+	}
+	src, err := g.gf.Content()
+	if err != nil {
+		return err
+	}
+	if src, err = g.format(src); err != nil {
+		return err
+	}
+	out.write(name, src, fmt.Sprintf("%d test skeletons", len(services)), nil)
+	return nil
+}
+
+// generateFuzzTargets generates the fuzz targets of services into the file
+// name, next to the factories they make requests with.
+func generateFuzzTargets(out *fileOutput, opts fileOptions, services []*protogen.Service, name string) error {
+	mp := mockPackageOf(out.files[0])
+	g := opts.newGenerator(name, mp.importPath)
+	g.source = out.files[0].GoImportPath
+	g.factoryOwners = opts.factoryOwners
+	n, err := g.GenerateFuzzTargets(services, string(mp.name))
+	if err != nil || n == 0 {
+		return err
+	}
+	src, err := g.gf.Content()
+	if err != nil {
+		return err
+	}
+	if src, err = g.format(src); err != nil {
+		return err
+	}
+	out.write(name, src, fmt.Sprintf("%d fuzz targets", n), nil)
+	return nil
+}
+
+// generateExamples generates the examples of the client mocks in pkg of the
+// services of out into the file name, in the external test package of the
+// mocks.
+func generateExamples(out *fileOutput, opts fileOptions, pkg *grpcmodel.Package, name string) error {
+	host := opts.exampleHosts[out.files[0]]
+	services := mockedServices(out, pkg)
+	if len(services) == 0 && !host {
+		return nil
+	}
+	mp := mockPackageOf(out.files[0])
+	g := opts.newGenerator(name, mp.importPath+"_test")
+	g.overrides = opts.mocks[mp.importPath]
+	if err := g.GenerateExamples(services, mp.importPath, string(mp.name)+"_test", host); err != nil {
+		return err
+	}
+	src, err := g.gf.Content()
+	if err != nil {
+		return err
+	}
+	if src, err = g.format(src); err != nil {
+		return err
+	}
+	out.write(name, src, fmt.Sprintf("%d examples", len(services)), nil)
+	return nil
+}
+
+// exampleHosts picks the file of units whose examples declare the reporter
+// shared by the examples of its mock package: the first one with services.
+func exampleHosts(units [][]*protogen.File) map[*protogen.File]bool {
+	hosts := make(map[*protogen.File]bool)
+	hosted := make(map[protogen.GoImportPath]bool)
+	for _, files := range units {
+		mp := mockPackageOf(files[0])
+		if hosted[mp.importPath] {
+			continue
+		}
+		for _, file := range files {
+			if len(file.Services) > 0 {
+				hosts[files[0]] = true
+				hosted[mp.importPath] = true
+				break
+			}
+		}
+	}
+	return hosts
 }
@@ -0,0 +1,583 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/pluginpb"
+	"gopkg.in/yaml.v3"
+)
+
+// TestMain runs the test binary as the plugin when a test executes it as one,
+// so that every run starts from the default options.
+func TestMain(m *testing.M) {
+	if os.Getenv("RUN_AS_PROTOC_GEN_GO_GRPC_MOCK") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// compileRequest compiles the files of testdata/proto to a request generating
+// them with param.
+func compileRequest(t *testing.T, param string, files ...string) *pluginpb.CodeGeneratorRequest {
+	t.Helper()
+	compiler := protocompile.Compiler{
+		Resolver:       protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: []string{"testdata/proto"}}),
+		SourceInfoMode: protocompile.SourceInfoStandard,
+	}
+	compiled, err := compiler.Compile(context.Background(), files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	descs := make([]protoreflect.FileDescriptor, len(compiled))
+	for i, file := range compiled {
+		descs[i] = file
+	}
+	return newRequest(param, descs...)
+}
+
+// newRequest returns a request generating files with param.
+func newRequest(param string, files ...protoreflect.FileDescriptor) *pluginpb.CodeGeneratorRequest {
+	req := &pluginpb.CodeGeneratorRequest{Parameter: proto.String(param)}
+	seen := make(map[string]bool)
+	var add func(protoreflect.FileDescriptor)
+	add = func(file protoreflect.FileDescriptor) {
+		if seen[file.Path()] {
+			return
+		}
+		seen[file.Path()] = true
+		for i := 0; i < file.Imports().Len(); i++ {
+			add(file.Imports().Get(i).FileDescriptor)
+		}
+		req.ProtoFile = append(req.ProtoFile, protodesc.ToFileDescriptorProto(file))
+	}
+	for _, file := range files {
+		req.FileToGenerate = append(req.FileToGenerate, file.Path())
+		add(file)
+	}
+	return req
+}
+
+// runPlugin runs the plugin executable name on req, or this plugin if name
+// is empty, and returns its response and the warnings it wrote to stderr.
+func runPlugin(t *testing.T, name string, req *pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, string) {
+	t.Helper()
+	in, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(name)
+	if name == "" {
+		cmd = pluginCommand()
+	}
+	cmd.Stdin = bytes.NewReader(in)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%s: %v\n%s", cmd, err, stderr.Bytes())
+	}
+	resp := &pluginpb.CodeGeneratorResponse{}
+	if err := proto.Unmarshal(out, resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp, stderr.String()
+}
+
+// pluginCommand returns a command running this plugin with args.
+func pluginCommand(args ...string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "RUN_AS_PROTOC_GEN_GO_GRPC_MOCK=1")
+	return cmd
+}
+
+func TestHelperNameCollisions(t *testing.T) {
+	req := compileRequest(t, "builders=true,factories=true,unimplemented_servers=true,interceptor_harness=true,fuzz_targets=true",
+		"collisions/collisions.proto")
+	resp, _ := runPlugin(t, "", req)
+	for _, name := range []string{
+		"ReqBuilder", "NewReqBuilder",
+		"FakeReq",
+		"PartialEchoServer",
+		"InterceptEcho_Unary",
+		"FuzzEchoServer_Unary",
+	} {
+		if !strings.Contains(resp.GetError(), "Go name "+name+" collides") {
+			t.Errorf("collision of %s not reported, got error:\n%s", name, resp.GetError())
+		}
+	}
+}
+
+func TestFactoryRequiredFieldWarning(t *testing.T) {
+	req := compileRequest(t, "factories=true", "factories/lookup.proto")
+	resp, warnings := runPlugin(t, "", req)
+	if resp.GetError() != "" {
+		t.Fatal(resp.GetError())
+	}
+	want := "factories.GetRequest.key: warning: FakeGetRequest fills it with an empty factories.key.Key, whose required field id is unset"
+	if !strings.Contains(warnings, want) {
+		t.Errorf("warnings do not contain %q:\n%s", want, warnings)
+	}
+}
+
+func TestTestOnlyOptionsRequireMockImportPrefix(t *testing.T) {
+	for _, o := range testOnlyOptions {
+		req := compileRequest(t, o.name+"=true", "collisions/collisions.proto")
+		resp, _ := runPlugin(t, "", req)
+		if want := o.name + " requires mock_import_prefix"; !strings.Contains(resp.GetError(), want) {
+			t.Errorf("error %q does not contain %q", resp.GetError(), want)
+		}
+	}
+}
+
+func TestServiceOverrides(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("services:\n  stores.a.Store: {mock_name: FakeStore}\n  stores.c.Store: {mock_name: FakeStoreC}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	req := compileRequest(t, "config="+config, "stores/a.proto", "stores/b.proto")
+	resp, warnings := runPlugin(t, "", req)
+	if resp.GetError() != "" {
+		t.Fatal(resp.GetError())
+	}
+	if want := "no service stores.c.Store in the request, its overrides are ignored"; !strings.Contains(warnings, want) {
+		t.Errorf("warnings do not contain %q:\n%s", want, warnings)
+	}
+	want := map[string]string{"example.com/stores/a/a_grpc_mock.pb.go": "FakeStore", "example.com/stores/b/b_grpc_mock.pb.go": "MockStoreClient"}
+	for _, file := range resp.File {
+		if name, ok := want[file.GetName()]; ok {
+			if !strings.Contains(file.GetContent(), "type "+name+" struct") {
+				t.Errorf("%s does not declare %s", file.GetName(), name)
+			}
+			delete(want, file.GetName())
+		}
+	}
+	for name := range want {
+		t.Errorf("no %s generated", name)
+	}
+}
+
+func TestConfigParams(t *testing.T) {
+	var options map[string]yaml.Node
+	content := "go_version: 1.20\nhook: [1e3, 0x10]\nmock_import_prefix: ~\n"
+	if err := yaml.Unmarshal([]byte(content), &options); err != nil {
+		t.Fatal(err)
+	}
+	params, err := configParams(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"go_version=1.20", "hook=1e3", "hook=0x10", "mock_import_prefix="}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("got %q, want %q", params, want)
+	}
+}
+
+// TestDirectoryStrategy checks that running the plugin once per directory, as
+// buf does by default, generates the files of a single run for all of them.
+func TestDirectoryStrategy(t *testing.T) {
+	const param = "module=example.com/gen,Mthird/nested.proto=example.com/gen/vendored/thirdparty,share_stream_mocks=true,builders=true,factories=true,examples=true,go_generate=buf"
+	dirs := [][]string{
+		{"xpkg/common/common.proto"},
+		{"xpkg/svc/svc.proto", "xpkg/svc/other.proto"},
+		{"shadow/shadow.proto"},
+	}
+	for _, single := range []string{"false", "true"} {
+		var all []string
+		perDir := make(map[string]string)
+		for _, files := range dirs {
+			all = append(all, files...)
+			resp, _ := runPlugin(t, "", compileRequest(t, param+",single_file="+single, files...))
+			if resp.GetError() != "" {
+				t.Fatal(resp.GetError())
+			}
+			for _, f := range resp.File {
+				if _, ok := perDir[f.GetName()]; ok {
+					t.Errorf("single_file=%s: %s generated by more than one directory", single, f.GetName())
+				}
+				perDir[f.GetName()] = f.GetContent()
+			}
+		}
+		resp, _ := runPlugin(t, "", compileRequest(t, param+",single_file="+single, all...))
+		if resp.GetError() != "" {
+			t.Fatal(resp.GetError())
+		}
+		if len(resp.File) != len(perDir) {
+			t.Errorf("single_file=%s: %d files generated per directory, %d at once", single, len(perDir), len(resp.File))
+		}
+		for _, f := range resp.File {
+			if perDir[f.GetName()] != f.GetContent() {
+				t.Errorf("single_file=%s: %s differs when generated per directory", single, f.GetName())
+			}
+		}
+	}
+}
+
+func TestFrameworkOverrides(t *testing.T) {
+	for _, tt := range []struct {
+		framework, param, want string
+	}{
+		{"testify", "", `config: service shadow.Shadow: unknown framework "testify"`},
+		{"mockery", "log_calls=true", "config: service shadow.Shadow: framework mockery is not supported with log_calls"},
+		{"gomock", "framework=minimock", ""},
+	} {
+		config := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(config, []byte("services:\n  shadow.Shadow: {framework: "+tt.framework+"}\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		resp, _ := runPlugin(t, "", compileRequest(t, "config="+config+","+tt.param, "shadow/shadow.proto"))
+		if !strings.Contains(resp.GetError(), tt.want) || tt.want == "" && resp.GetError() != "" {
+			t.Errorf("framework %s with %q: got error %q, want %q", tt.framework, tt.param, resp.GetError(), tt.want)
+		}
+	}
+}
+
+func TestProfileWarnsAboutDroppedOptions(t *testing.T) {
+	resp, warnings := runPlugin(t, "", compileRequest(t, "profile=full,contracts=false", "shadow/shadow.proto"))
+	if resp.GetError() != "" {
+		t.Fatal(resp.GetError())
+	}
+	for _, o := range testOnlyOptions {
+		want := "profile=full: warning: " + o.name + " is left out, as it requires mock_import_prefix"
+		if got := strings.Contains(warnings, want); got != (o.name != "contracts") {
+			t.Errorf("warnings contain %q: %v, want %v:\n%s", want, got, !got, warnings)
+		}
+	}
+}
+
+func TestSetterNameCollisions(t *testing.T) {
+	req := compileRequest(t, "builders=true,matchers=true,mock_import_prefix=example.com/mocks", "collisions/setters.proto")
+	resp, _ := runPlugin(t, "", req)
+	for _, want := range []string{
+		"method WithLabelsEntry of FieldsBuilder collides with the one generated for field labels_entry",
+		"method WithLabelsEntry of FieldsMatcher collides with the one generated for field labels_entry",
+		"method WithNameSet of FieldsMatcher collides with the one generated for field name_set",
+	} {
+		if !strings.Contains(resp.GetError(), want) {
+			t.Errorf("error does not contain %q:\n%s", want, resp.GetError())
+		}
+	}
+	if strings.Contains(resp.GetError(), "WithNameSet of FieldsBuilder") {
+		t.Errorf("builders have no WithNameSet, got error:\n%s", resp.GetError())
+	}
+}
+
+// TestGRPCAPI checks the stream types of the mocks for each grpc_api. The
+// generic ones are checked textually, as the grpc-go this module requires
+// predates them.
+func TestGRPCAPI(t *testing.T) {
+	const param = "module=example.com/gen,Mthird/nested.proto=example.com/gen/vendored/thirdparty"
+	for _, tt := range []struct {
+		api  string
+		want []string
+	}{
+		{"", []string{
+			"Chat(ctx context.Context, opts ...grpc.CallOption) (Refs_ChatClient, error)",
+			"Upload(server Refs_UploadServer) error",
+			"Watch(blob *thirdparty.Outer_Mid_Leaf, server Refs_WatchServer) error",
+		}},
+		{"v1.64", []string{
+			"Chat(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[Local_A_B, common.Ref], error)",
+			"Upload(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[thirdparty.Outer_Mid_Leaf, common.Ref_Inner], error)",
+			"Watch(ctx context.Context, in *thirdparty.Outer_Mid_Leaf, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Local_A_B], error)",
+			"Chat(server grpc.BidiStreamingServer[Local_A_B, common.Ref]) error",
+			"Upload(server grpc.ClientStreamingServer[thirdparty.Outer_Mid_Leaf, common.Ref_Inner]) error",
+			"Watch(blob *thirdparty.Outer_Mid_Leaf, server grpc.ServerStreamingServer[Local_A_B]) error",
+		}},
+	} {
+		resp, _ := runPlugin(t, "", compileRequest(t, param+",grpc_api="+tt.api, "xpkg/svc/svc.proto"))
+		if resp.GetError() != "" {
+			t.Fatal(resp.GetError())
+		}
+		var content string
+		for _, f := range resp.File {
+			if f.GetName() == "xpkg/svc/svc_grpc_mock.pb.go" {
+				content = f.GetContent()
+			}
+		}
+		if _, err := parser.ParseFile(token.NewFileSet(), "svc_grpc_mock.pb.go", content, 0); err != nil {
+			t.Errorf("grpc_api=%s: %v", tt.api, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(content, want) {
+				t.Errorf("grpc_api=%s: mocks do not contain %q", tt.api, want)
+			}
+		}
+	}
+}
+
+func TestCopyComments(t *testing.T) {
+	for _, framework := range []string{"gomock", "mockery", "minimock"} {
+		for _, copy := range []bool{false, true} {
+			param := "framework=" + framework + ",copy_comments=" + strconv.FormatBool(copy)
+			resp, _ := runPlugin(t, "", compileRequest(t, param, "docs/docs.proto"))
+			if resp.GetError() != "" {
+				t.Fatal(resp.GetError())
+			}
+			content := resp.File[0].GetContent()
+			for _, want := range []string{
+				"// MockLibraryClient is a mock of LibraryClient interface.\n//\n// Library lends books.\n",
+				"// MockLibraryServer is a mock of LibraryServer interface.\n//\n// Library lends books.\n",
+				"// Borrow mocks base method.\n//\n// Borrow lends a book.\n",
+				"// MockLibrary_BrowseClient is a mock of Library_BrowseClient interface.\n//\n// Browse streams the books of a shelf.\n",
+				"// MockLibrary_BrowseServer is a mock of Library_BrowseServer interface.\n//\n// Browse streams the books of a shelf.\n",
+			} {
+				if got := strings.Contains(content, want); got != copy {
+					t.Errorf("%s: mocks contain %q: %v, want %v", param, want, got, copy)
+				}
+			}
+			if strings.Contains(content, "// Return mocks base method.\n//\n") {
+				t.Errorf("%s: mocks document Return, which has no comment", param)
+			}
+		}
+	}
+}
+
+func TestSkipDeprecated(t *testing.T) {
+	deprecated := []string{
+		"MockLegacyClient", "MockLegacyServer", "MockLegacyGetClient",
+		"MockCurrentOldClient", "MockCurrentOldWatchClient",
+		"MockCurrent_OldWatchClient", "MockCurrent_OldWatchServer",
+	}
+	for _, skip := range []bool{false, true} {
+		param := "method_interfaces=true,skip_deprecated=" + strconv.FormatBool(skip)
+		resp, _ := runPlugin(t, "", compileRequest(t, param, "deprecated/deprecated.proto"))
+		if resp.GetError() != "" {
+			t.Fatal(resp.GetError())
+		}
+		content := resp.File[0].GetContent()
+		for _, name := range []string{"MockCurrentClient", "MockCurrentServer", "MockCurrentGetClient"} {
+			if !strings.Contains(content, "\ntype "+name+" struct") {
+				t.Errorf("%s: %s not generated", param, name)
+			}
+		}
+		for _, name := range deprecated {
+			if got := strings.Contains(content, "// Deprecated: Do not use.\ntype "+name+" struct"); got == skip {
+				t.Errorf("%s: deprecated %s generated: %v, want %v", param, name, got, !skip)
+			}
+		}
+		// Deprecated methods stay in the client and server mocks.
+		for _, method := range []string{
+			"(m *MockCurrentClient) Old(", "(m *MockCurrentClient) OldWatch(",
+			"(m *MockCurrentServer) Old(", "(m *MockCurrentServer) OldWatch(",
+		} {
+			if !strings.Contains(content, "// Deprecated: Do not use.\nfunc "+method) {
+				t.Errorf("%s: %s not generated as deprecated", param, method)
+			}
+		}
+	}
+}
+
+// generatedFiles returns the content of the files of resp, keyed by name.
+func generatedFiles(t *testing.T, resp *pluginpb.CodeGeneratorResponse) map[string]string {
+	t.Helper()
+	if resp.GetError() != "" {
+		t.Fatal(resp.GetError())
+	}
+	files := make(map[string]string)
+	for _, f := range resp.File {
+		files[f.GetName()] = f.GetContent()
+	}
+	return files
+}
+
+func TestConfigFile(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	content := "framework: mockery\nbuilders: true\ngo_version: 1.20\ngrpc_mocks: example.com/gen/grpcmock\n"
+	if err := os.WriteFile(config, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	resp, _ := runPlugin(t, "", compileRequest(t, "module=example.com/gen,framework=gomock,config="+config, "docs/docs.proto"))
+	files := generatedFiles(t, resp)
+	mocks := files["docs/docs_grpc_mock.pb.go"]
+	if !strings.Contains(mocks, `"go.uber.org/mock/gomock"`) {
+		t.Error("the framework parameter does not take precedence over the config file")
+	}
+	if !strings.Contains(mocks, "type BookBuilder struct") {
+		t.Error("builders of the config file not generated")
+	}
+	if !strings.Contains(files["grpcmock/grpc_mock.pb.go"], "type FakeServerStreamOf[") {
+		t.Error("go_version 1.20 of the config file not read as 1.20")
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("grpc_mocks: ${GRPCMOCK_TEST_MODULE}/grpcmock\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GRPCMOCK_TEST_DIR", dir)
+	t.Setenv("GRPCMOCK_TEST_MODULE", "example.com/gen")
+	resp, _ := runPlugin(t, "", compileRequest(t, "module=${GRPCMOCK_TEST_MODULE},config=${GRPCMOCK_TEST_DIR}/config.yaml", "docs/docs.proto"))
+	files := generatedFiles(t, resp)
+	for _, name := range []string{"docs/docs_grpc_mock.pb.go", "grpcmock/grpc_mock.pb.go"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("%s not generated", name)
+		}
+	}
+
+	in, err := proto.Marshal(compileRequest(t, "module=${GRPCMOCK_TEST_UNSET}", "docs/docs.proto"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := pluginCommand()
+	cmd.Stdin = bytes.NewReader(in)
+	out, err := cmd.CombinedOutput()
+	if want := "parameter module: environment variable GRPCMOCK_TEST_UNSET is not set"; err == nil || !strings.Contains(string(out), want) {
+		t.Errorf("unset variable: got %v, output %q, want it to fail with %q", err, out, want)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	markers := map[string]string{
+		"builders":      "type BookBuilder struct",
+		"matchers":      "type BookMatcher struct",
+		"contracts":     "type LibraryContracts struct",
+		"factories":     "func FakeBook(",
+		"fixtures":      "func LoadBook(",
+		"retry_helpers": "func (m *MockLibraryClient) BorrowFailsThenSucceeds(",
+		"log_calls":     "func (m *MockLibraryClient) LogCalls(",
+	}
+	all := []string{"builders", "matchers", "contracts", "factories", "fixtures", "retry_helpers", "log_calls"}
+	for _, tt := range []struct {
+		param string
+		want  []string
+	}{
+		{"profile=minimal", nil},
+		{"profile=standard", []string{"builders", "matchers", "contracts"}},
+		{"profile=full", all},
+		{"profile=full,fixtures=false", []string{"builders", "matchers", "contracts", "factories", "retry_helpers", "log_calls"}},
+		{"profile=full,framework=mockery", []string{"builders", "matchers", "contracts", "factories", "fixtures"}},
+	} {
+		resp, _ := runPlugin(t, "", compileRequest(t, "mock_import_prefix=example.com/mocks,"+tt.param, "docs/docs.proto"))
+		mocks, ok := generatedFiles(t, resp)["example.com/mocks/example.com/gen/docs/docs_grpc_mock.pb.go"]
+		if !ok {
+			t.Fatalf("%s: no mocks generated", tt.param)
+		}
+		want := make(map[string]bool)
+		for _, option := range tt.want {
+			want[option] = true
+		}
+		for _, option := range all {
+			if got := strings.Contains(mocks, markers[option]); got != want[option] {
+				t.Errorf("%s: %s generated: %v, want %v", tt.param, option, got, want[option])
+			}
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	req := compileRequest(t, "dry_run=true,builders=true,manifest=manifest.json", "docs/docs.proto", "collisions/collisions.proto")
+	resp, report := runPlugin(t, "", req)
+	if len(resp.File) != 0 {
+		t.Errorf("dry run generated %d files", len(resp.File))
+	}
+	if !strings.Contains(resp.GetError(), "Go name ReqBuilder collides") {
+		t.Errorf("dry run error %q does not report the collision", resp.GetError())
+	}
+	for _, want := range []string{
+		"protoc-gen-go-grpc-mock: dry run: docs/docs.proto: would generate example.com/gen/docs/docs_grpc_mock.pb.go (4 mocks, ",
+		"protoc-gen-go-grpc-mock: dry run: collisions/collisions.proto: skipped, errors\n",
+		"protoc-gen-go-grpc-mock: dry run: 1 files, 1 skipped, 2 errors, 0 warnings\n",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report does not contain %q:\n%s", want, report)
+		}
+	}
+}
+
+func TestManifest(t *testing.T) {
+	req := compileRequest(t, "module=example.com/gen,manifest=mocks.json,grpc_mocks=example.com/gen/grpcmock", "docs/docs.proto", "deprecated/deprecated.proto")
+	resp, _ := runPlugin(t, "", req)
+	files := generatedFiles(t, resp)
+	var manifest struct {
+		Files []manifestFile `json:"files"`
+	}
+	if err := json.Unmarshal([]byte(files["mocks.json"]), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	want := []manifestFile{
+		{Path: "docs/docs_grpc_mock.pb.go", Package: "example.com/gen/docs", Sources: []string{"docs/docs.proto"}},
+		{Path: "deprecated/deprecated_grpc_mock.pb.go", Package: "example.com/gen/deprecated", Sources: []string{"deprecated/deprecated.proto"}},
+		{Path: "grpcmock/grpc_mock.pb.go", Package: "example.com/gen/grpcmock", Sources: []string{"docs/docs.proto"}},
+	}
+	if !reflect.DeepEqual(manifest.Files, want) {
+		t.Errorf("manifest lists %+v, want %+v", manifest.Files, want)
+	}
+	for _, f := range manifest.Files {
+		if _, ok := files[f.Path]; !ok {
+			t.Errorf("manifest lists %s, which is not generated", f.Path)
+		}
+	}
+	if len(files) != len(manifest.Files)+1 {
+		t.Errorf("%d files generated besides the manifest, it lists %d", len(files)-1, len(manifest.Files))
+	}
+}
+
+// replay runs the plugin on the request saved in file with -replay, writing
+// the files to dir, and returns what it logged.
+func replay(t *testing.T, file, dir string) string {
+	t.Helper()
+	out, err := pluginCommand("-replay", file, "-out", dir).CombinedOutput()
+	if err != nil {
+		t.Fatalf("-replay: %v\n%s", err, out)
+	}
+	return string(out)
+}
+
+func TestReplay(t *testing.T) {
+	dump := filepath.Join(t.TempDir(), "request.bin")
+	resp, _ := runPlugin(t, "", compileRequest(t, "builders=true,debug_request_file="+dump, "docs/docs.proto"))
+	files := generatedFiles(t, resp)
+	dir := t.TempDir()
+	logged := replay(t, dump, dir)
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		written, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(written) != content {
+			t.Errorf("-replay wrote %s differently from the response", name)
+		}
+		if !strings.Contains(logged, "wrote "+path+"\n") {
+			t.Errorf("-replay did not log writing %s:\n%s", path, logged)
+		}
+	}
+
+	// Replaying again leaves the files, which are unchanged, untouched.
+	var stale []string
+	for name := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.Chtimes(path, time.Time{}, time.Unix(0, 0)); err != nil {
+			t.Fatal(err)
+		}
+		stale = append(stale, path)
+	}
+	logged = replay(t, dump, dir)
+	for _, path := range stale {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(time.Unix(0, 0)) || !strings.Contains(logged, "unchanged "+path+"\n") {
+			t.Errorf("-replay rewrote %s, which is unchanged:\n%s", path, logged)
+		}
+	}
+}
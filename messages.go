@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// messageOwners assigns every message the methods of units use as input or
+// output, and with nested every message reachable from those through message
+// fields, to the first file that uses it and is in the same Go package, so
+// the code for it is generated exactly once. Messages of other Go packages
+// are left out.
+func messageOwners(units [][]*protogen.File, nested bool) map[protogen.GoIdent]*protogen.File {
+	owners := make(map[protogen.GoIdent]*protogen.File)
+	for _, files := range units {
+		for _, file := range files {
+			for _, msg := range usedMessages(file, nested) {
+				if _, ok := owners[msg.GoIdent]; !ok {
+					owners[msg.GoIdent] = file
+				}
+			}
+		}
+	}
+	return owners
+}
+
+// ownedMessages returns the messages of owners assigned to file, in the
+// order its methods use them.
+func ownedMessages(file *protogen.File, owners map[protogen.GoIdent]*protogen.File, nested bool) []*protogen.Message {
+	var msgs []*protogen.Message
+	for _, msg := range usedMessages(file, nested) {
+		if owners[msg.GoIdent] == file {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+// usedMessages returns the messages of the Go package of file that its
+// methods use, as described by messageOwners, in the order they are used.
+func usedMessages(file *protogen.File, nested bool) []*protogen.Message {
+	var msgs []*protogen.Message
+	seen := make(map[protogen.GoIdent]bool)
+	var visit func(*protogen.Message)
+	visit = func(msg *protogen.Message) {
+		if msg.GoIdent.GoImportPath != file.GoImportPath || seen[msg.GoIdent] {
+			return
+		}
+		seen[msg.GoIdent] = true
+		if !msg.Desc.IsMapEntry() {
+			msgs = append(msgs, msg)
+		}
+		if !nested {
+			return
+		}
+		for _, field := range msg.Fields {
+			if field.Message != nil {
+				visit(field.Message)
+			}
+		}
+	}
+	for _, s := range file.Services {
+		for _, m := range s.Methods {
+			visit(m.Input)
+			visit(m.Output)
+		}
+	}
+	return msgs
+}
+
+// builderData is the data the "builder" template is executed with.
+type builderData struct {
+	Message string // message type
+	Builder string // builder type
+	Fields  []builderField
+	Entries []mapEntry
+}
+
+// builderField is a setter of a builder or matcher.
+type builderField struct {
+	Name   string // field name in the proto file
+	Method string
+	Param  string // parameter type of the setter
+	Assign string // statement assigning the parameter v to the message
+}
+
+// builderData prepares the builder of msg.
+func (g *generator) builderData(msg *protogen.Message) *builderData {
+	return &builderData{
+		Message: g.gf.QualifiedGoIdent(msg.GoIdent),
+		Builder: msg.GoIdent.GoName + "Builder",
+		Fields:  g.setters(msg, "b.msg"),
+		Entries: g.mapEntries(msg),
+	}
+}
+
+// setters returns the setters of the fields of msg, assigning to the
+// message target.
+func (g *generator) setters(msg *protogen.Message, target string) []builderField {
+	var fields []builderField
+	for _, field := range msg.Fields {
+		goType, pointer := fieldGoType(g.gf, field)
+		f := builderField{
+			Name:   string(field.Desc.Name()),
+			Method: "With" + field.GoName,
+			Param:  goType,
+			Assign: fmt.Sprintf("%s.%s = v", target, field.GoName),
+		}
+		switch {
+		case field.Oneof != nil && !field.Oneof.Desc.IsSynthetic():
+			f.Assign = fmt.Sprintf("%s.%s = &%s{%s: v}", target, field.Oneof.GoName, g.gf.QualifiedGoIdent(field.GoIdent), field.GoName)
+		case pointer:
+			f.Assign = fmt.Sprintf("%s.%s = &v", target, field.GoName)
+		case field.Desc.IsList():
+			f.Param = "..." + goType[len("[]"):]
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// mapEntry is a method adding or expecting a single entry of a map field.
+type mapEntry struct {
+	Name   string // field name in the proto file
+	Method string
+	Field  string // Go name of the field
+	Key    string // key type
+	Value  string // value type
+}
+
+// mapEntries returns the entry methods of the map fields of msg.
+func (g *generator) mapEntries(msg *protogen.Message) []mapEntry {
+	var entries []mapEntry
+	for _, field := range msg.Fields {
+		if !field.Desc.IsMap() {
+			continue
+		}
+		key, _ := fieldGoType(g.gf, field.Message.Fields[0])
+		value, _ := fieldGoType(g.gf, field.Message.Fields[1])
+		entries = append(entries, mapEntry{
+			Name:   string(field.Desc.Name()),
+			Method: "With" + field.GoName + "Entry",
+			Field:  field.GoName,
+			Key:    key,
+			Value:  value,
+		})
+	}
+	return entries
+}
+
+// oneofCase is a matcher method expecting a oneof to hold a field, with any
+// value.
+type oneofCase struct {
+	Name    string // field name in the proto file
+	Oneof   string // oneof name in the proto file
+	Method  string
+	Field   string // Go name of the oneof
+	Wrapper string // type of the oneof holding the field
+}
+
+// oneofCases returns the case methods of the fields of the oneofs of msg.
+func (g *generator) oneofCases(msg *protogen.Message) []oneofCase {
+	var cases []oneofCase
+	for _, oneof := range msg.Oneofs {
+		if oneof.Desc.IsSynthetic() {
+			continue
+		}
+		for _, field := range oneof.Fields {
+			cases = append(cases, oneofCase{
+				Name:    string(field.Desc.Name()),
+				Oneof:   string(oneof.Desc.Name()),
+				Method:  "With" + field.GoName + "Set",
+				Field:   oneof.GoName,
+				Wrapper: g.gf.QualifiedGoIdent(field.GoIdent),
+			})
+		}
+	}
+	return cases
+}
+
+// fixtureData is the data the "fixture" template is executed with.
+type fixtureData struct {
+	Name    string // message name, the helpers are Load<Name> and SaveGolden<Name>
+	Message string // message type
+}
+
+// fixtureData prepares the golden file helpers of msg.
+func (g *generator) fixtureData(msg *protogen.Message) *fixtureData {
+	return &fixtureData{
+		Name:    msg.GoIdent.GoName,
+		Message: g.gf.QualifiedGoIdent(msg.GoIdent),
+	}
+}
+
+// matcherData is the data the "matcher" template is executed with.
+type matcherData struct {
+	Name    string // message name
+	Message string // message type
+	Matcher string // matcher type
+	Any     string // spelling of the empty interface
+	Fields  []builderField
+	Entries []mapEntry
+	Cases   []oneofCase
+}
+
+// matcherData prepares the matcher of msg.
+func (g *generator) matcherData(msg *protogen.Message) *matcherData {
+	return &matcherData{
+		Name:    msg.GoIdent.GoName,
+		Message: g.gf.QualifiedGoIdent(msg.GoIdent),
+		Matcher: msg.GoIdent.GoName + "Matcher",
+		Any:     g.emptyInterface(),
+		Fields:  g.setters(msg, "m.want"),
+		Entries: g.mapEntries(msg),
+		Cases:   g.oneofCases(msg),
+	}
+}
+
+// fieldGoType returns the Go type of field in the message struct, and
+// whether the struct holds a pointer to it, like protoc-gen-go does.
+func fieldGoType(g *protogen.GeneratedFile, field *protogen.Field) (goType string, pointer bool) {
+	if field.Desc.IsWeak() {
+		return "struct{}", false
+	}
+
+	pointer = field.Desc.HasPresence()
+	switch field.Desc.Kind() {
+	case protoreflect.BoolKind:
+		goType = "bool"
+	case protoreflect.EnumKind:
+		goType = g.QualifiedGoIdent(field.Enum.GoIdent)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		goType = "int32"
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		goType = "uint32"
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		goType = "int64"
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		goType = "uint64"
+	case protoreflect.FloatKind:
+		goType = "float32"
+	case protoreflect.DoubleKind:
+		goType = "float64"
+	case protoreflect.StringKind:
+		goType = "string"
+	case protoreflect.BytesKind:
+		goType = "[]byte"
+		pointer = false // nil slices already mark absence
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		goType = "*" + g.QualifiedGoIdent(field.Message.GoIdent)
+		pointer = false
+	}
+	switch {
+	case field.Desc.IsList():
+		return "[]" + goType, false
+	case field.Desc.IsMap():
+		keyType, _ := fieldGoType(g, field.Message.Fields[0])
+		valType, _ := fieldGoType(g, field.Message.Fields[1])
+		return fmt.Sprintf("map[%v]%v", keyType, valType), false
+	}
+	return goType, pointer
+}
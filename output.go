@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+// output adds generated files to the plugin response, or only records them
+// when running with dry_run.
+type output struct {
+	plugin *protogen.Plugin
+	dryRun bool
+	mu     sync.Mutex // guards plugin.NewGeneratedFile
+
+	written []outputFile
+	skipped []outputFile
+}
+
+type outputFile struct {
+	source     string   // path of the proto file
+	sources    []string // paths of all proto files the file is generated from
+	name       string   // generated file name, empty for skipped files
+	importPath string   // Go package of generated Go files
+	summary    string
+	size       int
+}
+
+// scratchFile returns a file to render generated code into. It is skipped
+// right away, the rendered code is post-processed and added to the response
+// by flush under the same name.
+func (o *output) scratchFile(name string, importPath protogen.GoImportPath) *protogen.GeneratedFile {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	gf := o.plugin.NewGeneratedFile(name, importPath)
+	gf.Skip()
+	return gf
+}
+
+// fileOutput buffers what was generated for one output unit, so files can be
+// generated concurrently and still be added to the response in request
+// order.
+type fileOutput struct {
+	files      []*protogen.File      // proto files the output is generated from
+	importPath protogen.GoImportPath // Go package of the files, the mock package of files if empty
+	pending    []pendingFile
+	skipped    string // reason no files were generated, may be empty
+}
+
+type pendingFile struct {
+	name     string
+	content  []byte
+	summary  string
+	annotate func(*protogen.GeneratedFile) // may be nil
+}
+
+func (f *fileOutput) write(name string, content []byte, summary string, annotate func(*protogen.GeneratedFile)) {
+	f.pending = append(f.pending, pendingFile{name: name, content: content, summary: summary, annotate: annotate})
+}
+
+func (f *fileOutput) skip(reason string) {
+	f.skipped = reason
+}
+
+// flush adds the files buffered in f to the response, or only records them
+// in dry runs.
+func (o *output) flush(f *fileOutput) error {
+	var sources []string
+	for _, file := range f.files {
+		sources = append(sources, file.Desc.Path())
+	}
+	source := strings.Join(sources, ", ")
+	if f.skipped != "" {
+		o.skipped = append(o.skipped, outputFile{source: source, sources: sources, summary: f.skipped})
+	}
+	importPath := f.importPath
+	if importPath == "" {
+		importPath = mockPackageOf(f.files[0]).importPath
+	}
+	for _, p := range f.pending {
+		written := outputFile{source: source, sources: sources, name: p.name, summary: p.summary, size: len(p.content)}
+		if path.Ext(p.name) == ".go" {
+			written.importPath = string(importPath)
+		}
+		o.written = append(o.written, written)
+		if o.dryRun {
+			continue
+		}
+		o.mu.Lock()
+		gf := o.plugin.NewGeneratedFile(p.name, importPath)
+		o.mu.Unlock()
+		if _, err := gf.Write(p.content); err != nil {
+			return err
+		}
+		if p.annotate != nil {
+			p.annotate(gf)
+		}
+	}
+	return nil
+}
+
+// writeReport describes what a run without dry_run would have generated.
+func (o *output) writeReport(w io.Writer, diags *diagnostics) {
+	for _, f := range o.written {
+		fmt.Fprintf(w, "protoc-gen-go-grpc-mock: dry run: %s: would generate %s (%s, %d bytes)\n", f.source, f.name, f.summary, f.size)
+	}
+	for _, f := range o.skipped {
+		fmt.Fprintf(w, "protoc-gen-go-grpc-mock: dry run: %s: skipped, %s\n", f.source, f.summary)
+	}
+	var errs, warnings int
+	for _, d := range diags.list {
+		if d.severity == severityError {
+			errs++
+		} else {
+			warnings++
+		}
+	}
+	fmt.Fprintf(w, "protoc-gen-go-grpc-mock: dry run: %d files, %d skipped, %d errors, %d warnings\n", len(o.written), len(o.skipped), errs, warnings)
+}
+
+// manifestFile is an entry of the manifest.
+type manifestFile struct {
+	Path    string   `json:"path"`
+	Package string   `json:"package,omitempty"`
+	Sources []string `json:"sources"`
+}
+
+// writeManifest adds a JSON manifest of the files written so far to the
+// response under name. Paths are relative to the output directory, with the
+// module prefix stripped like protogen does for the files themselves.
+func (o *output) writeManifest(name, module string) error {
+	files := make([]manifestFile, 0, len(o.written))
+	for _, f := range o.written {
+		p := f.name
+		if module != "" {
+			p = strings.TrimPrefix(p, module+"/")
+		}
+		files = append(files, manifestFile{Path: p, Package: f.importPath, Sources: f.sources})
+	}
+	data, err := json.MarshalIndent(struct {
+		Files []manifestFile `json:"files"`
+	}{files}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if module != "" {
+		name = path.Join(module, name)
+	}
+	gf := o.plugin.NewGeneratedFile(name, "")
+	_, err = gf.Write(append(data, '\n'))
+	return err
+}
+
+// moduleParam returns the value of the module= plugin parameter, which
+// protogen handles itself instead of passing it on to the flags.
+func moduleParam(param string) string {
+	for _, p := range strings.Split(param, ",") {
+		if v := strings.TrimPrefix(p, "module="); v != p {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,597 @@
+// Package grpcmodel converts protobuf service descriptors into a model of the
+// Go interfaces that protoc-gen-go-grpc generates for them.
+package grpcmodel
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+// MethodType classifies a method by the streaming direction of its RPC.
+type MethodType int
+
+const (
+	MethodTypeUnary MethodType = iota
+	MethodTypeClientStream
+	MethodTypeServerStream
+	MethodTypeBidirectionalStream
+)
+
+// MethodTypeOf returns the streaming kind of m.
+func MethodTypeOf(m *protogen.Method) MethodType {
+	if !m.Desc.IsStreamingClient() && !m.Desc.IsStreamingServer() {
+		return MethodTypeUnary
+	}
+	if !m.Desc.IsStreamingServer() {
+		return MethodTypeClientStream
+	}
+	if !m.Desc.IsStreamingClient() {
+		return MethodTypeServerStream
+	}
+	return MethodTypeBidirectionalStream
+}
+
+// FileToModel converts the services of file into the interfaces
+// protoc-gen-go-grpc generates for them: a client and a server interface per
+// service, plus a client and a server stream interface per streaming method.
+// Interfaces are sorted by name.
+func FileToModel(file *protogen.File) *Package {
+	pkg := &Package{
+		Name:    string(file.GoPackageName),
+		PkgPath: string(file.GoImportPath),
+	}
+
+	for _, s := range file.Services {
+		clientIface := &Interface{Name: ClientInterfaceName(s)}
+		serverIface := &Interface{Name: ServerInterfaceName(s)}
+		for _, m := range s.Methods {
+			switch MethodTypeOf(m) {
+			case MethodTypeUnary:
+				clientMethod, serverMethod := makeUnaryMethods(m)
+				clientIface.AddMethod(clientMethod)
+				serverIface.AddMethod(serverMethod)
+			case MethodTypeServerStream:
+				clientMethod, serverMethod, ifaces := makeServerStreamMethods(m)
+				pkg.Interfaces = append(pkg.Interfaces, ifaces...)
+				clientIface.AddMethod(clientMethod)
+				serverIface.AddMethod(serverMethod)
+			case MethodTypeClientStream:
+				clientMethod, serverMethod, ifaces := makeClientStreamMethods(m)
+				pkg.Interfaces = append(pkg.Interfaces, ifaces...)
+				clientIface.AddMethod(clientMethod)
+				serverIface.AddMethod(serverMethod)
+			case MethodTypeBidirectionalStream:
+				clientMethod, serverMethod, ifaces := makeBidirectionalStreamMethods(m)
+				pkg.Interfaces = append(pkg.Interfaces, ifaces...)
+				clientIface.AddMethod(clientMethod)
+				serverIface.AddMethod(serverMethod)
+			}
+		}
+		pkg.Interfaces = append(pkg.Interfaces, clientIface, serverIface)
+	}
+	sort.Slice(pkg.Interfaces, func(i, j int) bool {
+		return pkg.Interfaces[i].Name < pkg.Interfaces[j].Name
+	})
+
+	return pkg
+}
+
+// GenericStreams replaces the stream interfaces of the methods of file in the
+// signatures of the interfaces of pkg by the generic stream types of
+// grpc-go 1.64 and later, such as grpc.ServerStreamingClient[Res], which
+// protoc-gen-go-grpc 1.4 and later declares them as aliases of. The stream
+// interfaces themselves are left in place.
+func GenericStreams(file *protogen.File, pkg *Package) {
+	generic := make(map[string]Type)
+	for _, s := range file.Services {
+		for _, m := range s.Methods {
+			in := &NamedType{Package: string(m.Input.GoIdent.GoImportPath), Type: m.Input.GoIdent.GoName}
+			out := &NamedType{Package: string(m.Output.GoIdent.GoImportPath), Type: m.Output.GoIdent.GoName}
+			stream := func(name string, args ...Type) Type {
+				return &NamedType{Package: "google.golang.org/grpc", Type: name, TypeArgs: args}
+			}
+			switch MethodTypeOf(m) {
+			case MethodTypeServerStream:
+				generic[StreamClientInterfaceName(m)] = stream("ServerStreamingClient", out)
+				generic[StreamServerInterfaceName(m)] = stream("ServerStreamingServer", out)
+			case MethodTypeClientStream:
+				generic[StreamClientInterfaceName(m)] = stream("ClientStreamingClient", in, out)
+				generic[StreamServerInterfaceName(m)] = stream("ClientStreamingServer", in, out)
+			case MethodTypeBidirectionalStream:
+				generic[StreamClientInterfaceName(m)] = stream("BidiStreamingClient", in, out)
+				generic[StreamServerInterfaceName(m)] = stream("BidiStreamingServer", in, out)
+			}
+		}
+	}
+	replace := func(params []*Parameter) {
+		for _, p := range params {
+			if t, ok := p.Type.(*NamedType); ok && t.Package == "" && generic[t.Type] != nil {
+				p.Type = generic[t.Type]
+			}
+		}
+	}
+	for _, intf := range pkg.Interfaces {
+		for _, m := range intf.Methods {
+			replace(m.In)
+			replace(m.Out)
+		}
+	}
+}
+
+// Qualify sets the package of the named types of pkg without one, which are
+// the interfaces declared next to the interfaces of pkg, to importPath, for
+// code that refers to them from another package.
+func Qualify(pkg *Package, importPath string) {
+	var qualify func(t Type)
+	qualify = func(t Type) {
+		switch t := t.(type) {
+		case *NamedType:
+			if t.Package == "" {
+				t.Package = importPath
+			}
+			for _, arg := range t.TypeArgs {
+				qualify(arg)
+			}
+		case *PointerType:
+			qualify(t.Type)
+		case *ArrayType:
+			qualify(t.Type)
+		case *MapType:
+			qualify(t.Key)
+			qualify(t.Value)
+		}
+	}
+	for _, intf := range pkg.Interfaces {
+		for _, m := range intf.Methods {
+			for _, p := range m.In {
+				qualify(p.Type)
+			}
+			for _, p := range m.Out {
+				qualify(p.Type)
+			}
+			if m.Variadic != nil {
+				qualify(m.Variadic.Type)
+			}
+		}
+	}
+}
+
+// MethodInterfaces returns a single-method client interface for every method
+// of the services of file, sorted by name. Unlike the interfaces of
+// FileToModel, protoc-gen-go-grpc does not generate these.
+func MethodInterfaces(file *protogen.File) []*Interface {
+	var ifaces []*Interface
+	for _, s := range file.Services {
+		for _, m := range s.Methods {
+			iface := &Interface{Name: MethodInterfaceName(m)}
+			iface.AddMethod(makeClientMethod(m))
+			ifaces = append(ifaces, iface)
+		}
+	}
+	sort.Slice(ifaces, func(i, j int) bool {
+		return ifaces[i].Name < ifaces[j].Name
+	})
+	return ifaces
+}
+
+// SimpleClientInterfaces returns a client interface without the trailing
+// grpc.CallOption parameters for every service of file, sorted by name. Like
+// the interfaces of MethodInterfaces, protoc-gen-go-grpc does not generate
+// these.
+func SimpleClientInterfaces(file *protogen.File) []*Interface {
+	var ifaces []*Interface
+	for _, s := range file.Services {
+		iface := &Interface{Name: SimpleClientInterfaceName(s)}
+		for _, m := range s.Methods {
+			clientMethod := makeClientMethod(m)
+			clientMethod.Variadic = nil
+			iface.AddMethod(clientMethod)
+		}
+		ifaces = append(ifaces, iface)
+	}
+	sort.Slice(ifaces, func(i, j int) bool {
+		return ifaces[i].Name < ifaces[j].Name
+	})
+	return ifaces
+}
+
+// ClientInterfaceName returns the name of the client interface of s.
+func ClientInterfaceName(s *protogen.Service) string {
+	return s.GoName + "Client"
+}
+
+// ServerInterfaceName returns the name of the server interface of s.
+func ServerInterfaceName(s *protogen.Service) string {
+	return s.GoName + "Server"
+}
+
+// SimpleClientInterfaceName returns the name of the client interface of s
+// without call options.
+func SimpleClientInterfaceName(s *protogen.Service) string {
+	return s.GoName + "SimpleClient"
+}
+
+// MethodInterfaceName returns the name of the single-method client interface
+// of m.
+func MethodInterfaceName(m *protogen.Method) string {
+	return m.Parent.GoName + m.GoName + "Client"
+}
+
+// StreamClientInterfaceName returns the name of the client stream interface
+// of the streaming method m.
+func StreamClientInterfaceName(m *protogen.Method) string {
+	return fmt.Sprintf("%s_%sClient", m.Parent.GoName, m.GoName)
+}
+
+// StreamServerInterfaceName returns the name of the server stream interface
+// of the streaming method m.
+func StreamServerInterfaceName(m *protogen.Method) string {
+	return fmt.Sprintf("%s_%sServer", m.Parent.GoName, m.GoName)
+}
+
+// makeClientMethod returns the method of the client interface for m.
+func makeClientMethod(m *protogen.Method) *Method {
+	var clientMethod *Method
+	switch MethodTypeOf(m) {
+	case MethodTypeUnary:
+		clientMethod, _ = makeUnaryMethods(m)
+	case MethodTypeServerStream:
+		clientMethod, _, _ = makeServerStreamMethods(m)
+	case MethodTypeClientStream:
+		clientMethod, _, _ = makeClientStreamMethods(m)
+	case MethodTypeBidirectionalStream:
+		clientMethod, _, _ = makeBidirectionalStreamMethods(m)
+	}
+	return clientMethod
+}
+
+func makeUnaryMethods(m *protogen.Method) (*Method, *Method) {
+	clientMethod := &Method{
+		Name: m.GoName,
+		In: []*Parameter{
+			{Name: "ctx", Type: &NamedType{Package: "context", Type: "Context"}},
+			{Name: "in", Type: &PointerType{Type: &NamedType{Package: string(m.Input.GoIdent.GoImportPath), Type: m.Input.GoIdent.GoName}}},
+		},
+		Out: []*Parameter{
+			{Type: &PointerType{Type: &NamedType{Package: string(m.Output.GoIdent.GoImportPath), Type: m.Output.GoIdent.GoName}}},
+			{Type: PredeclaredType("error")},
+		},
+		Variadic: &Parameter{Name: "opts", Type: &NamedType{Package: "google.golang.org/grpc", Type: "CallOption"}},
+	}
+	serverMethod := &Method{
+		Name: m.GoName,
+		In: []*Parameter{
+			{Name: "ctx", Type: &NamedType{Package: "context", Type: "Context"}},
+			{Name: "in", Type: &PointerType{Type: &NamedType{Package: string(m.Input.GoIdent.GoImportPath), Type: m.Input.GoIdent.GoName}}},
+		},
+		Out: []*Parameter{
+			{Type: &PointerType{Type: &NamedType{Package: string(m.Output.GoIdent.GoImportPath), Type: m.Output.GoIdent.GoName}}},
+			{Type: PredeclaredType("error")},
+		},
+	}
+	return clientMethod, serverMethod
+}
+
+func makeServerStreamMethods(m *protogen.Method) (*Method, *Method, []*Interface) {
+	clientIfaceName := StreamClientInterfaceName(m)
+	serverIfaceName := StreamServerInterfaceName(m)
+	clientMethod := &Method{
+		Name: m.GoName,
+		In: []*Parameter{
+			{Name: "ctx", Type: &NamedType{Package: "context", Type: "Context"}},
+			{Name: "in", Type: &PointerType{Type: &NamedType{Package: string(m.Input.GoIdent.GoImportPath), Type: m.Input.GoIdent.GoName}}},
+		},
+		Out: []*Parameter{
+			{Type: &NamedType{Type: clientIfaceName}},
+			{Type: PredeclaredType("error")},
+		},
+		Variadic: &Parameter{Name: "opts", Type: &NamedType{Package: "google.golang.org/grpc", Type: "CallOption"}},
+	}
+	serverMethod := &Method{
+		Name: m.GoName,
+		In: []*Parameter{
+			{Name: "blob", Type: &PointerType{Type: &NamedType{Package: string(m.Input.GoIdent.GoImportPath), Type: m.Input.GoIdent.GoName}}},
+			{Name: "server", Type: &NamedType{Type: serverIfaceName}},
+		},
+		Out: []*Parameter{
+			{Type: PredeclaredType("error")},
+		},
+	}
+	clientIface := &Interface{
+		Name:    clientIfaceName,
+		Methods: BaseClientStreamMethods(),
+	}
+	clientIface.AddMethod(&Method{
+		Name: "Recv",
+		Out: []*Parameter{
+			{Type: &PointerType{Type: &NamedType{Package: string(m.Output.GoIdent.GoImportPath), Type: m.Output.GoIdent.GoName}}},
+			{Type: PredeclaredType("error")},
+		},
+	})
+	serverIface := &Interface{
+		Name:    serverIfaceName,
+		Methods: BaseServerStreamMethods(),
+	}
+	serverIface.AddMethod(&Method{
+		Name: "Send",
+		In: []*Parameter{
+			{Type: &PointerType{Type: &NamedType{Package: string(m.Output.GoIdent.GoImportPath), Type: m.Output.GoIdent.GoName}}},
+		},
+		Out: []*Parameter{
+			{Type: PredeclaredType("error")},
+		},
+	})
+
+	return clientMethod, serverMethod, []*Interface{clientIface, serverIface}
+}
+
+func makeClientStreamMethods(m *protogen.Method) (*Method, *Method, []*Interface) {
+	clientIfaceName := StreamClientInterfaceName(m)
+	serverIfaceName := StreamServerInterfaceName(m)
+	clientMethod := &Method{
+		Name: m.GoName,
+		In: []*Parameter{
+			{Name: "ctx", Type: &NamedType{Package: "context", Type: "Context"}},
+		},
+		Out: []*Parameter{
+			{Type: &NamedType{Type: clientIfaceName}},
+			{Type: PredeclaredType("error")},
+		},
+		Variadic: &Parameter{Name: "opts", Type: &NamedType{Package: "google.golang.org/grpc", Type: "CallOption"}},
+	}
+	serverMethod := &Method{
+		Name: m.GoName,
+		In: []*Parameter{
+			{Name: "server", Type: &NamedType{Type: serverIfaceName}},
+		},
+		Out: []*Parameter{
+			{Type: PredeclaredType("error")},
+		},
+	}
+	clientIface := &Interface{
+		Name:    clientIfaceName,
+		Methods: BaseClientStreamMethods(),
+	}
+	clientIface.AddMethod(&Method{
+		Name: "Send",
+		In: []*Parameter{
+			{Type: &PointerType{Type: &NamedType{Package: string(m.Input.GoIdent.GoImportPath), Type: m.Input.GoIdent.GoName}}},
+		},
+		Out: []*Parameter{
+			{Type: PredeclaredType("error")},
+		},
+	})
+	clientIface.AddMethod(&Method{
+		Name: "CloseAndRecv",
+		Out: []*Parameter{
+			{Type: &PointerType{Type: &NamedType{Package: string(m.Output.GoIdent.GoImportPath), Type: m.Output.GoIdent.GoName}}},
+			{Type: PredeclaredType("error")},
+		},
+	})
+	serverIface := &Interface{
+		Name:    serverIfaceName,
+		Methods: BaseServerStreamMethods(),
+	}
+	serverIface.AddMethod(&Method{
+		Name: "SendAndClose",
+		In: []*Parameter{
+			{Type: &PointerType{Type: &NamedType{Package: string(m.Output.GoIdent.GoImportPath), Type: m.Output.GoIdent.GoName}}},
+		},
+		Out: []*Parameter{
+			{Type: PredeclaredType("error")},
+		},
+	})
+	serverIface.AddMethod(&Method{
+		Name: "Recv",
+		Out: []*Parameter{
+			{Type: &PointerType{Type: &NamedType{Package: string(m.Input.GoIdent.GoImportPath), Type: m.Input.GoIdent.GoName}}},
+			{Type: PredeclaredType("error")},
+		},
+	})
+
+	return clientMethod, serverMethod, []*Interface{clientIface, serverIface}
+}
+
+func makeBidirectionalStreamMethods(m *protogen.Method) (*Method, *Method, []*Interface) {
+	clientIfaceName := StreamClientInterfaceName(m)
+	serverIfaceName := StreamServerInterfaceName(m)
+	clientMethod := &Method{
+		Name: m.GoName,
+		In: []*Parameter{
+			{Name: "ctx", Type: &NamedType{Package: "context", Type: "Context"}},
+		},
+		Out: []*Parameter{
+			{Type: &NamedType{Type: clientIfaceName}},
+			{Type: PredeclaredType("error")},
+		},
+		Variadic: &Parameter{Name: "opts", Type: &NamedType{Package: "google.golang.org/grpc", Type: "CallOption"}},
+	}
+	serverMethod := &Method{
+		Name: m.GoName,
+		In: []*Parameter{
+			{Name: "server", Type: &NamedType{Type: serverIfaceName}},
+		},
+		Out: []*Parameter{
+			{Type: PredeclaredType("error")},
+		},
+	}
+	clientIface := &Interface{
+		Name:    clientIfaceName,
+		Methods: BaseClientStreamMethods(),
+	}
+	clientIface.AddMethod(&Method{
+		Name: "Send",
+		In: []*Parameter{
+			{Type: &PointerType{Type: &NamedType{Package: string(m.Input.GoIdent.GoImportPath), Type: m.Input.GoIdent.GoName}}},
+		},
+		Out: []*Parameter{
+			{Type: PredeclaredType("error")},
+		},
+	})
+	clientIface.AddMethod(&Method{
+		Name: "Recv",
+		Out: []*Parameter{
+			{Type: &PointerType{Type: &NamedType{Package: string(m.Output.GoIdent.GoImportPath), Type: m.Output.GoIdent.GoName}}},
+			{Type: PredeclaredType("error")},
+		},
+	})
+	serverIface := &Interface{
+		Name:    serverIfaceName,
+		Methods: BaseServerStreamMethods(),
+	}
+	serverIface.AddMethod(&Method{
+		Name: "Send",
+		In: []*Parameter{
+			{Type: &PointerType{Type: &NamedType{Package: string(m.Output.GoIdent.GoImportPath), Type: m.Output.GoIdent.GoName}}},
+		},
+		Out: []*Parameter{
+			{Type: PredeclaredType("error")},
+		},
+	})
+	serverIface.AddMethod(&Method{
+		Name: "Recv",
+		Out: []*Parameter{
+			{Type: &PointerType{Type: &NamedType{Package: string(m.Input.GoIdent.GoImportPath), Type: m.Input.GoIdent.GoName}}},
+			{Type: PredeclaredType("error")},
+		},
+	})
+
+	return clientMethod, serverMethod, []*Interface{clientIface, serverIface}
+}
+
+// BaseClientStreamMethods returns the methods of grpc.ClientStream, which
+// every client stream interface embeds.
+func BaseClientStreamMethods() []*Method {
+	return []*Method{
+		{
+			Name: "Header",
+			Out: []*Parameter{
+				{Type: &NamedType{Package: "google.golang.org/grpc/metadata", Type: "MD"}},
+				{Type: PredeclaredType("error")},
+			},
+		},
+		{
+			Name: "Trailer",
+			Out: []*Parameter{
+				{Type: &NamedType{Package: "google.golang.org/grpc/metadata", Type: "MD"}},
+			},
+		},
+		{
+			Name: "CloseSend",
+			Out: []*Parameter{
+				{Type: PredeclaredType("error")},
+			},
+		},
+		{
+			Name: "Context",
+			Out: []*Parameter{
+				{Type: &NamedType{Package: "context", Type: "Context"}},
+			},
+		},
+		{
+			Name: "SendMsg",
+			In: []*Parameter{
+				{Name: "arg0", Type: PredeclaredType("interface{}")},
+			},
+			Out: []*Parameter{
+				{Type: PredeclaredType("error")},
+			},
+		},
+		{
+			Name: "RecvMsg",
+			In: []*Parameter{
+				{Name: "arg0", Type: PredeclaredType("interface{}")},
+			},
+			Out: []*Parameter{
+				{Type: PredeclaredType("error")},
+			},
+		},
+	}
+}
+
+// BaseServerStreamMethods returns the methods of grpc.ServerStream, which
+// every server stream interface embeds.
+func BaseServerStreamMethods() []*Method {
+	return []*Method{
+		{
+			Name: "SetHeader",
+			In: []*Parameter{
+				{Type: &NamedType{Package: "google.golang.org/grpc/metadata", Type: "MD"}},
+			},
+			Out: []*Parameter{
+				{Type: PredeclaredType("error")},
+			},
+		},
+		{
+			Name: "SendHeader",
+			In: []*Parameter{
+				{Type: &NamedType{Package: "google.golang.org/grpc/metadata", Type: "MD"}},
+			},
+			Out: []*Parameter{
+				{Type: PredeclaredType("error")},
+			},
+		},
+		{
+			Name: "SetTrailer",
+			In: []*Parameter{
+				{Type: &NamedType{Package: "google.golang.org/grpc/metadata", Type: "MD"}},
+			},
+		},
+		{
+			Name: "Context",
+			Out: []*Parameter{
+				{Type: &NamedType{Package: "context", Type: "Context"}},
+			},
+		},
+		{
+			Name: "SendMsg",
+			In: []*Parameter{
+				{Name: "arg0", Type: PredeclaredType("interface{}")},
+			},
+			Out: []*Parameter{
+				{Type: PredeclaredType("error")},
+			},
+		},
+		{
+			Name: "RecvMsg",
+			In: []*Parameter{
+				{Name: "arg0", Type: PredeclaredType("interface{}")},
+			},
+			Out: []*Parameter{
+				{Type: PredeclaredType("error")},
+			},
+		},
+	}
+}
+
+// ServerTransportStreamMethods returns the methods of
+// grpc.ServerTransportStream, which interceptors reach through
+// grpc.ServerTransportStreamFromContext.
+func ServerTransportStreamMethods() []*Method {
+	md := &NamedType{Package: "google.golang.org/grpc/metadata", Type: "MD"}
+	return []*Method{
+		{
+			Name: "Method",
+			Out: []*Parameter{
+				{Type: PredeclaredType("string")},
+			},
+		},
+		{
+			Name: "SetHeader",
+			In:   []*Parameter{{Type: md}},
+			Out:  []*Parameter{{Type: PredeclaredType("error")}},
+		},
+		{
+			Name: "SendHeader",
+			In:   []*Parameter{{Type: md}},
+			Out:  []*Parameter{{Type: PredeclaredType("error")}},
+		},
+		{
+			Name: "SetTrailer",
+			In:   []*Parameter{{Type: md}},
+			Out:  []*Parameter{{Type: PredeclaredType("error")}},
+		},
+	}
+}
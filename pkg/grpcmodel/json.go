@@ -0,0 +1,145 @@
+package grpcmodel
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// JSONPackage is the JSON form of a Package. Unlike the model, whose
+// types are Go interfaces, every type carries an explicit kind so the output
+// can be consumed by tools that are not written in Go.
+type JSONPackage struct {
+	Source     string          `json:"source,omitempty"`
+	Name       string          `json:"name"`
+	PkgPath    string          `json:"pkgPath"`
+	Interfaces []JSONInterface `json:"interfaces"`
+}
+
+// JSONInterface is the JSON form of an Interface.
+type JSONInterface struct {
+	Name    string       `json:"name"`
+	Methods []JSONMethod `json:"methods"`
+}
+
+// JSONMethod is the JSON form of a Method.
+type JSONMethod struct {
+	Name     string          `json:"name"`
+	In       []JSONParameter `json:"in"`
+	Out      []JSONParameter `json:"out"`
+	Variadic *JSONParameter  `json:"variadic,omitempty"`
+}
+
+// JSONParameter is the JSON form of a Parameter.
+type JSONParameter struct {
+	Name string   `json:"name,omitempty"`
+	Type JSONType `json:"type"`
+}
+
+// JSONType is the JSON form of a Type. Kind is one of "named",
+// "pointer", "slice", "array", "map" or "predeclared".
+type JSONType struct {
+	Kind    string     `json:"kind"`
+	Package string     `json:"package,omitempty"` // named types only
+	Name    string     `json:"name,omitempty"`    // named and predeclared types
+	Len     int        `json:"len,omitempty"`     // arrays only
+	Key     *JSONType  `json:"key,omitempty"`     // maps only
+	Elem    *JSONType  `json:"elem,omitempty"`    // pointers, slices, arrays and maps
+	Args    []JSONType `json:"args,omitempty"`    // type arguments of generic named types
+}
+
+// MarshalJSON encodes pkg, generated from the proto file source, as indented
+// JSON.
+func MarshalJSON(source string, pkg *Package) ([]byte, error) {
+	out := JSONPackage{
+		Source:     source,
+		Name:       pkg.Name,
+		PkgPath:    pkg.PkgPath,
+		Interfaces: make([]JSONInterface, 0, len(pkg.Interfaces)),
+	}
+	for _, intf := range pkg.Interfaces {
+		ji := JSONInterface{Name: intf.Name, Methods: make([]JSONMethod, 0, len(intf.Methods))}
+		for _, m := range intf.Methods {
+			jm := JSONMethod{
+				Name: m.Name,
+				In:   make([]JSONParameter, 0, len(m.In)),
+				Out:  make([]JSONParameter, 0, len(m.Out)),
+			}
+			for _, p := range m.In {
+				jp, err := jsonParameter(p)
+				if err != nil {
+					return nil, fmt.Errorf("%s.%s: %w", intf.Name, m.Name, err)
+				}
+				jm.In = append(jm.In, jp)
+			}
+			for _, p := range m.Out {
+				jp, err := jsonParameter(p)
+				if err != nil {
+					return nil, fmt.Errorf("%s.%s: %w", intf.Name, m.Name, err)
+				}
+				jm.Out = append(jm.Out, jp)
+			}
+			if m.Variadic != nil {
+				jp, err := jsonParameter(m.Variadic)
+				if err != nil {
+					return nil, fmt.Errorf("%s.%s: %w", intf.Name, m.Name, err)
+				}
+				jm.Variadic = &jp
+			}
+			ji.Methods = append(ji.Methods, jm)
+		}
+		out.Interfaces = append(out.Interfaces, ji)
+	}
+	return json.MarshalIndent(out, "", "  ")
+}
+
+func jsonParameter(p *Parameter) (JSONParameter, error) {
+	t, err := jsonType(p.Type)
+	if err != nil {
+		return JSONParameter{}, err
+	}
+	return JSONParameter{Name: p.Name, Type: *t}, nil
+}
+
+func jsonType(t Type) (*JSONType, error) {
+	switch t := t.(type) {
+	case *NamedType:
+		named := &JSONType{Kind: "named", Package: t.Package, Name: t.Type}
+		for _, a := range t.TypeArgs {
+			arg, err := jsonType(a)
+			if err != nil {
+				return nil, err
+			}
+			named.Args = append(named.Args, *arg)
+		}
+		return named, nil
+	case PredeclaredType:
+		return &JSONType{Kind: "predeclared", Name: string(t)}, nil
+	case *PointerType:
+		elem, err := jsonType(t.Type)
+		if err != nil {
+			return nil, err
+		}
+		return &JSONType{Kind: "pointer", Elem: elem}, nil
+	case *ArrayType:
+		elem, err := jsonType(t.Type)
+		if err != nil {
+			return nil, err
+		}
+		if t.Len < 0 {
+			return &JSONType{Kind: "slice", Elem: elem}, nil
+		}
+		return &JSONType{Kind: "array", Len: t.Len, Elem: elem}, nil
+	case *MapType:
+		key, err := jsonType(t.Key)
+		if err != nil {
+			return nil, err
+		}
+		elem, err := jsonType(t.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &JSONType{Kind: "map", Key: key, Elem: elem}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %T", t)
+	}
+}
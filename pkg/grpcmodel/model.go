@@ -0,0 +1,75 @@
+package grpcmodel
+
+// Package is the model of the Go interfaces generated for the services of a
+// proto file, which mocks are rendered from.
+type Package struct {
+	Name       string // Go package name
+	PkgPath    string // Go import path
+	Interfaces []*Interface
+}
+
+// Interface is a Go interface of a Package.
+type Interface struct {
+	Name    string
+	Methods []*Method
+}
+
+// AddMethod adds m to the methods of intf.
+func (intf *Interface) AddMethod(m *Method) {
+	intf.Methods = append(intf.Methods, m)
+}
+
+// Method is a method of an Interface.
+type Method struct {
+	Name     string
+	In, Out  []*Parameter
+	Variadic *Parameter // may be nil
+}
+
+// Parameter is a parameter or result of a Method. Results are unnamed.
+type Parameter struct {
+	Name string // may be empty
+	Type Type
+}
+
+// Type is the type of a Parameter: a *NamedType, a *PointerType, an
+// *ArrayType, a *MapType or a PredeclaredType.
+type Type interface {
+	isType()
+}
+
+// NamedType is a named type, such as a message or grpc.CallOption, with the
+// type arguments of a generic type. Types without a Package are declared in
+// the package the interfaces are declared in.
+type NamedType struct {
+	Package  string // import path
+	Type     string // name
+	TypeArgs []Type
+}
+
+// PointerType is a pointer to Type.
+type PointerType struct {
+	Type Type
+}
+
+// ArrayType is an array of Len elements of Type, or a slice if Len is
+// negative.
+type ArrayType struct {
+	Len  int
+	Type Type
+}
+
+// MapType is a map from Key to Value.
+type MapType struct {
+	Key, Value Type
+}
+
+// PredeclaredType is a predeclared type such as error or string, or the
+// empty interface, written as interface{}.
+type PredeclaredType string
+
+func (*NamedType) isType()      {}
+func (*PointerType) isType()    {}
+func (*ArrayType) isType()      {}
+func (*MapType) isType()        {}
+func (PredeclaredType) isType() {}
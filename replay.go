@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// requestParam returns the value of the plugin parameter name in req, or an
+// empty string if it is not set.
+func requestParam(req *pluginpb.CodeGeneratorRequest, name string) string {
+	var value string
+	for _, param := range strings.Split(req.GetParameter(), ",") {
+		if k, v, ok := strings.Cut(param, "="); ok && k == name {
+			value = v
+		}
+	}
+	return value
+}
+
+// writeResponseFiles writes the files of resp below dir, the way protoc
+// would have. Files whose content is already on disk are left untouched, so
+// their modification time does not invalidate downstream build steps.
+func writeResponseFiles(resp *pluginpb.CodeGeneratorResponse, dir string, log io.Writer) error {
+	if resp.Error != nil {
+		return fmt.Errorf("%s", resp.GetError())
+	}
+	for _, f := range resp.File {
+		if f.GetInsertionPoint() != "" {
+			return fmt.Errorf("%s: insertion points are not supported in replay mode", f.GetName())
+		}
+		path := filepath.Join(dir, filepath.FromSlash(f.GetName()))
+		content := []byte(f.GetContent())
+		if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, content) {
+			fmt.Fprintf(log, "unchanged %s\n", path)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintf(log, "wrote %s\n", path)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/sorcererxw/protoc-gen-go-grpc-mock/pkg/grpcmodel"
+)
+
+// sourceElement is the service or method an interface or interface method
+// was generated from.
+type sourceElement struct {
+	location   protogen.Location
+	comments   protogen.CommentSet
+	deprecated bool
+	skipped    bool // by the overrides of the config file
+}
+
+// sourceElements maps interface names and "<interface>.<method>" to the
+// proto elements they were generated from. Stream interfaces map to their
+// method.
+func sourceElements(file *protogen.File) map[string]sourceElement {
+	elements := make(map[string]sourceElement)
+	for _, s := range file.Services {
+		clientName := grpcmodel.ClientInterfaceName(s)
+		serverName := grpcmodel.ServerInterfaceName(s)
+		service := sourceElement{
+			location:   s.Location,
+			comments:   s.Comments,
+			deprecated: s.Desc.Options().(*descriptorpb.ServiceOptions).GetDeprecated(),
+		}
+		elements[clientName] = service
+		elements[serverName] = service
+		elements[grpcmodel.SimpleClientInterfaceName(s)] = service
+		for _, m := range s.Methods {
+			method := sourceElement{
+				location:   m.Location,
+				comments:   m.Comments,
+				deprecated: service.deprecated || m.Desc.Options().(*descriptorpb.MethodOptions).GetDeprecated(),
+				skipped:    overrides[string(s.Desc.FullName())].Methods[string(m.Desc.Name())].Skip,
+			}
+			elements[clientName+"."+m.GoName] = method
+			elements[serverName+"."+m.GoName] = method
+			elements[grpcmodel.SimpleClientInterfaceName(s)+"."+m.GoName] = method
+			elements[grpcmodel.MethodInterfaceName(m)] = method
+			elements[grpcmodel.MethodInterfaceName(m)+"."+m.GoName] = method
+			if grpcmodel.MethodTypeOf(m) != grpcmodel.MethodTypeUnary {
+				elements[grpcmodel.StreamClientInterfaceName(m)] = method
+				elements[grpcmodel.StreamServerInterfaceName(m)] = method
+			}
+		}
+	}
+	return elements
+}
+
+// withoutOmitted returns intfs without the interfaces generated from methods
+// the config file skips, and with skip_deprecated from deprecated services and
+// methods. The client and server interfaces of a service keep those methods,
+// their mocks could not implement them otherwise.
+func withoutOmitted(intfs []*grpcmodel.Interface, elements map[string]sourceElement) []*grpcmodel.Interface {
+	kept := intfs[:0]
+	for _, intf := range intfs {
+		e := elements[intf.Name]
+		if !e.skipped && !(*skipDeprecated && e.deprecated) {
+			kept = append(kept, intf)
+		}
+	}
+	return kept
+}
+
+// fileComments collects the leading comments of services and methods, keyed
+// like sourceElements.
+func fileComments(file *protogen.File) map[string]string {
+	comments := make(map[string]string)
+	for key, e := range sourceElements(file) {
+		if text := strings.TrimSpace(string(e.comments.Leading)); text != "" {
+			comments[key] = strings.TrimRight(string(e.comments.Leading), "\n")
+		}
+	}
+	return comments
+}
+
+// annotateMocks links the mock types, mock methods and recorder methods in gf
+// to the proto elements they were generated from. protogen only emits the
+// annotations when the annotate_code parameter is set.
+func annotateMocks(gf *protogen.GeneratedFile, pkg *grpcmodel.Package, elements map[string]sourceElement, mockName func(string) string) {
+	for _, intf := range pkg.Interfaces {
+		e, ok := elements[intf.Name]
+		if !ok {
+			continue
+		}
+		mock := mockName(intf.Name)
+		gf.Annotate(mock, e.location)
+		for _, m := range intf.Methods {
+			if me, ok := elements[intf.Name+"."+m.Name]; ok {
+				gf.Annotate(mock+"."+m.Name, me.location)
+				gf.Annotate(mock+"MockRecorder."+m.Name, me.location)
+			}
+		}
+	}
+}
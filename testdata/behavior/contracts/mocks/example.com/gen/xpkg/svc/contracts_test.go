@@ -0,0 +1,48 @@
+package mock_svc_test
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+
+	"example.com/gen/mocks/example.com/gen/xpkg/svc"
+	"example.com/gen/xpkg/common"
+	"example.com/gen/xpkg/svc"
+)
+
+func refsContracts() *mock_svc.RefsContracts {
+	var suite mock_svc.RefsContracts
+	suite.Add("GetEchoesInner", func(t *testing.T, client svc.RefsClient) {
+		ref, err := client.Get(context.Background(), &common.Ref_Inner{Id: "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ref.GetInner().GetId(); got != "a" {
+			t.Errorf("Get returned inner %q, want a", got)
+		}
+	})
+	return &suite
+}
+
+func get(_ context.Context, in *common.Ref_Inner) (*common.Ref, error) {
+	return &common.Ref{Inner: in}, nil
+}
+
+type refsServer struct {
+	svc.UnimplementedRefsServer
+}
+
+func (refsServer) Get(ctx context.Context, in *common.Ref_Inner) (*common.Ref, error) {
+	return get(ctx, in)
+}
+
+func TestRunServer(t *testing.T) {
+	refsContracts().RunServer(t, refsServer{})
+}
+
+func TestRunServerMock(t *testing.T) {
+	srv := mock_svc.NewMockRefsServer(gomock.NewController(t))
+	srv.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(get)
+	refsContracts().RunServer(t, srv)
+}
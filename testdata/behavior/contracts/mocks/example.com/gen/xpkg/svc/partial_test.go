@@ -0,0 +1,28 @@
+package mock_svc_test
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"example.com/gen/mocks/example.com/gen/xpkg/svc"
+	"example.com/gen/xpkg/common"
+	"example.com/gen/xpkg/svc"
+)
+
+// The server mocks embed UnimplementedRefsServer, as protoc-gen-go-grpc
+// requires of servers by default.
+var _ svc.UnsafeRefsServer = &mock_svc.MockRefsServer{}
+
+func TestPartialServer(t *testing.T) {
+	srv := mock_svc.PartialRefsServer(refsServer{})
+	ref, err := srv.Get(context.Background(), &common.Ref_Inner{Id: "a"})
+	if err != nil || ref.GetInner().GetId() != "a" {
+		t.Errorf("Get() = %v, %v, want inner a", ref, err)
+	}
+	if err := srv.Chat(nil); status.Code(err) != codes.Unimplemented {
+		t.Errorf("Chat() = %v, want code Unimplemented", err)
+	}
+}
@@ -0,0 +1,58 @@
+package grpcmock_test
+
+import (
+	"io"
+	"testing"
+
+	"example.com/gen/grpcmock"
+	"example.com/gen/vendored/thirdparty"
+	"example.com/gen/xpkg/common"
+	"example.com/gen/xpkg/svc"
+)
+
+var (
+	_ svc.Refs_WatchServer  = &grpcmock.FakeServerStreamOf[thirdparty.Outer_Mid_Leaf, svc.Local_A_B]{}
+	_ svc.Refs_UploadServer = &grpcmock.FakeServerStreamOf[thirdparty.Outer_Mid_Leaf, common.Ref_Inner]{}
+	_ svc.Refs_ChatServer   = &grpcmock.FakeServerStreamOf[svc.Local_A_B, common.Ref]{}
+	_ svc.Refs_WatchClient  = &grpcmock.FakeClientStreamOf[thirdparty.Outer_Mid_Leaf, svc.Local_A_B]{}
+	_ svc.Refs_UploadClient = &grpcmock.FakeClientStreamOf[thirdparty.Outer_Mid_Leaf, common.Ref_Inner]{}
+	_ svc.Refs_ChatClient   = &grpcmock.FakeClientStreamOf[svc.Local_A_B, common.Ref]{}
+)
+
+func TestFakeServerStreamOf(t *testing.T) {
+	stream := &grpcmock.FakeServerStreamOf[thirdparty.Outer_Mid_Leaf, common.Ref_Inner]{
+		FakeServerStream: grpcmock.FakeServerStream{In: []any{&thirdparty.Outer_Mid_Leaf{Value: "a"}}},
+	}
+	leaf, err := stream.Recv()
+	if err != nil || leaf.GetValue() != "a" {
+		t.Fatalf("Recv() = %v, %v, want a", leaf, err)
+	}
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Fatalf("Recv() after In = %v, want io.EOF", err)
+	}
+	if err := stream.SendAndClose(&common.Ref_Inner{Id: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if sent := stream.SentMessages(); len(sent) != 1 || sent[0].GetId() != "b" {
+		t.Errorf("SentMessages() = %v, want [b]", sent)
+	}
+}
+
+func TestFakeClientStreamOf(t *testing.T) {
+	stream := &grpcmock.FakeClientStreamOf[thirdparty.Outer_Mid_Leaf, common.Ref_Inner]{
+		FakeClientStream: grpcmock.FakeClientStream{In: []any{&common.Ref_Inner{Id: "b"}}},
+	}
+	if err := stream.Send(&thirdparty.Outer_Mid_Leaf{Value: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	inner, err := stream.CloseAndRecv()
+	if err != nil || inner.GetId() != "b" {
+		t.Fatalf("CloseAndRecv() = %v, %v, want b", inner, err)
+	}
+	if !stream.Closed() {
+		t.Error("CloseAndRecv did not close the stream")
+	}
+	if sent := stream.SentMessages(); len(sent) != 1 || sent[0].GetValue() != "a" {
+		t.Errorf("SentMessages() = %v, want [a]", sent)
+	}
+}
@@ -0,0 +1,97 @@
+package grpcmock_test
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"example.com/gen/grpcmock"
+	"example.com/gen/vendored/thirdparty"
+	"example.com/gen/xpkg/svc"
+)
+
+// headerStream is the stream a stream interceptor wraps the server stream
+// in, setting a header before the first message is sent.
+type headerStream struct {
+	grpc.ServerStream
+	sent bool
+}
+
+func (s *headerStream) SendMsg(m interface{}) error {
+	if !s.sent {
+		s.sent = true
+		if err := s.SendHeader(metadata.Pairs("wrapped", "true")); err != nil {
+			return err
+		}
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+func TestFakeServerStream(t *testing.T) {
+	stream := &grpcmock.FakeServerStream{In: []interface{}{&thirdparty.Outer_Mid_Leaf{Value: "a"}}}
+	interceptor := func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &headerStream{ServerStream: ss})
+	}
+	if err := interceptor(refsServer{}, stream, nil, svc.Refs_ServiceDesc.Streams[0].Handler); err != nil {
+		t.Fatal(err)
+	}
+	if got := stream.Received(); got != 1 {
+		t.Errorf("Received() = %d, want 1", got)
+	}
+	sent := stream.Sent()
+	if len(sent) != 1 || sent[0].(*svc.Local_A_B).GetLeaf().GetValue() != "a" {
+		t.Errorf("Sent() = %v, want the leaf a", sent)
+	}
+	if header, ok := stream.Header(); !ok || !reflect.DeepEqual(header.Get("wrapped"), []string{"true"}) {
+		t.Errorf("Header() = %v, %v, want wrapped: true sent", header, ok)
+	}
+}
+
+func TestFakeServerStreamErrors(t *testing.T) {
+	recvErr, sendErr := errors.New("recv"), errors.New("send")
+	stream := &grpcmock.FakeServerStream{RecvErr: recvErr, SendErr: sendErr}
+	if err := stream.RecvMsg(&thirdparty.Outer_Mid_Leaf{}); err != recvErr {
+		t.Errorf("RecvMsg() = %v, want %v", err, recvErr)
+	}
+	if err := stream.SendMsg(&svc.Local_A_B{}); err != sendErr {
+		t.Errorf("SendMsg() = %v, want %v", err, sendErr)
+	}
+	if len(stream.Sent()) != 0 {
+		t.Errorf("Sent() = %v, want none", stream.Sent())
+	}
+}
+
+func TestFakeClientStream(t *testing.T) {
+	stream := &grpcmock.FakeClientStream{
+		In:       []interface{}{&svc.Local_A_B{Leaf: &thirdparty.Outer_Mid_Leaf{Value: "b"}}},
+		HeaderMD: metadata.Pairs("k", "v"),
+	}
+	leaf := &thirdparty.Outer_Mid_Leaf{Value: "a"}
+	if err := stream.SendMsg(leaf); err != nil {
+		t.Fatal(err)
+	}
+	leaf.Value = "changed"
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	var got svc.Local_A_B
+	if err := stream.RecvMsg(&got); err != nil || got.GetLeaf().GetValue() != "b" {
+		t.Errorf("RecvMsg() = %v, %v, want the leaf b", &got, err)
+	}
+	if err := stream.RecvMsg(&got); err != io.EOF {
+		t.Errorf("RecvMsg() after In = %v, want io.EOF", err)
+	}
+	if sent := stream.Sent(); len(sent) != 1 || sent[0].(*thirdparty.Outer_Mid_Leaf).GetValue() != "a" {
+		t.Errorf("Sent() = %v, want the leaf a as sent", sent)
+	}
+	if !stream.Closed() {
+		t.Error("Closed() = false after CloseSend")
+	}
+	if header, err := stream.Header(); err != nil || !reflect.DeepEqual(header.Get("k"), []string{"v"}) {
+		t.Errorf("Header() = %v, %v, want k: v", header, err)
+	}
+}
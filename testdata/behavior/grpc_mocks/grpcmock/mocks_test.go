@@ -0,0 +1,55 @@
+package grpcmock_test
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"example.com/gen/grpcmock"
+	"example.com/gen/vendored/thirdparty"
+	"example.com/gen/xpkg/svc"
+)
+
+var (
+	_ grpc.ClientStream          = &grpcmock.MockClientStream{}
+	_ grpc.ServerStream          = &grpcmock.MockServerStream{}
+	_ grpc.ServerTransportStream = &grpcmock.MockServerTransportStream{}
+)
+
+type refsServer struct {
+	svc.UnimplementedRefsServer
+}
+
+func (refsServer) Watch(leaf *thirdparty.Outer_Mid_Leaf, stream svc.Refs_WatchServer) error {
+	return stream.Send(&svc.Local_A_B{Leaf: leaf})
+}
+
+func TestMockServerStream(t *testing.T) {
+	stream := grpcmock.NewMockServerStream(gomock.NewController(t))
+	stream.EXPECT().RecvMsg(gomock.Any()).DoAndReturn(func(m interface{}) error {
+		proto.Merge(m.(proto.Message), &thirdparty.Outer_Mid_Leaf{Value: "a"})
+		return nil
+	})
+	stream.EXPECT().SendMsg(gomock.Any()).DoAndReturn(func(m interface{}) error {
+		if got := m.(*svc.Local_A_B).GetLeaf().GetValue(); got != "a" {
+			t.Errorf("sent leaf %q, want a", got)
+		}
+		return nil
+	})
+	if err := svc.Refs_ServiceDesc.Streams[0].Handler(refsServer{}, stream); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMockServerTransportStream(t *testing.T) {
+	transport := grpcmock.NewMockServerTransportStream(gomock.NewController(t))
+	transport.EXPECT().SetHeader(metadata.Pairs("k", "v")).Return(nil)
+	ctx := grpc.NewContextWithServerTransportStream(context.Background(), transport)
+	if err := grpc.SetHeader(ctx, metadata.Pairs("k", "v")); err != nil {
+		t.Fatal(err)
+	}
+}
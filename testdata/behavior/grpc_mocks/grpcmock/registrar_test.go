@@ -0,0 +1,54 @@
+package grpcmock_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"example.com/gen/grpcmock"
+	"example.com/gen/xpkg/svc"
+)
+
+// failures is a testing.TB recording the failures reported to it.
+type failures struct {
+	testing.TB
+	errors []string
+}
+
+func (f *failures) Helper() {}
+
+func (f *failures) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func TestRegistrar(t *testing.T) {
+	var r grpcmock.Registrar
+	svc.RegisterRefsServer(&r, refsServer{})
+	if services := r.Services(); len(services) != 1 || services[0].Desc != &svc.Refs_ServiceDesc {
+		t.Errorf("Services() = %v, want Refs", services)
+	}
+	want := []string{"/xpkg.svc.Refs/Get", "/xpkg.svc.Refs/Watch", "/xpkg.svc.Refs/Upload", "/xpkg.svc.Refs/Chat"}
+	if got := r.Methods(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Methods() = %q, want %q", got, want)
+	}
+	r.AssertRegistered(t, "xpkg.svc.Refs", "/xpkg.svc.Refs/Get")
+	r.AssertNotRegistered(t, "xpkg.svc.Other", "/xpkg.svc.Other/Get")
+
+	f := &failures{TB: t}
+	r.AssertRegistered(f, "xpkg.svc.Other")
+	r.AssertNotRegistered(f, "/xpkg.svc.Refs/Chat")
+	if want := []string{"xpkg.svc.Other is not registered", "/xpkg.svc.Refs/Chat is registered"}; !reflect.DeepEqual(f.errors, want) {
+		t.Errorf("failures %q, want %q", f.errors, want)
+	}
+}
+
+func TestRegistrarRejectsDuplicates(t *testing.T) {
+	var r grpcmock.Registrar
+	svc.RegisterRefsServer(&r, refsServer{})
+	defer func() {
+		if recover() == nil {
+			t.Error("registering Refs twice did not panic")
+		}
+	}()
+	svc.RegisterRefsServer(&r, refsServer{})
+}
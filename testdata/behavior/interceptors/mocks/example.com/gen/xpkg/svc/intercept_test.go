@@ -0,0 +1,67 @@
+package mock_svc_test
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"example.com/gen/grpcmock"
+	"example.com/gen/mocks/example.com/gen/xpkg/svc"
+	"example.com/gen/vendored/thirdparty"
+	"example.com/gen/xpkg/common"
+	"example.com/gen/xpkg/svc"
+)
+
+func TestInterceptUnary(t *testing.T) {
+	srv := mock_svc.NewMockRefsServer(gomock.NewController(t))
+	srv.EXPECT().Get(gomock.Any(), gomock.Any()).Return(&common.Ref{Kind: common.Kind_KIND_USER}, nil)
+	var method string
+	interceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		method = info.FullMethod
+		return handler(ctx, req)
+	}
+	ref, err := mock_svc.InterceptRefs_Get(context.Background(), interceptor, srv, &common.Ref_Inner{Id: "a"})
+	if err != nil || ref.GetKind() != common.Kind_KIND_USER {
+		t.Errorf("InterceptRefs_Get() = %v, %v, want KIND_USER", ref, err)
+	}
+	if method != "/xpkg.svc.Refs/Get" {
+		t.Errorf("interceptor ran for %q, want /xpkg.svc.Refs/Get", method)
+	}
+}
+
+func TestInterceptUnaryRejects(t *testing.T) {
+	srv := mock_svc.NewMockRefsServer(gomock.NewController(t))
+	interceptor := func(context.Context, interface{}, *grpc.UnaryServerInfo, grpc.UnaryHandler) (interface{}, error) {
+		return nil, status.Error(codes.PermissionDenied, "denied")
+	}
+	if _, err := mock_svc.InterceptRefs_Get(context.Background(), interceptor, srv, &common.Ref_Inner{}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("InterceptRefs_Get() = %v, want code PermissionDenied", err)
+	}
+}
+
+func TestInterceptStream(t *testing.T) {
+	srv := mock_svc.NewMockRefsServer(gomock.NewController(t))
+	srv.EXPECT().Watch(gomock.Any(), gomock.Any()).DoAndReturn(func(leaf *thirdparty.Outer_Mid_Leaf, stream svc.Refs_WatchServer) error {
+		return stream.Send(&svc.Local_A_B{Leaf: leaf})
+	})
+	var info *grpc.StreamServerInfo
+	interceptor := func(srv interface{}, ss grpc.ServerStream, i *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		info = i
+		return handler(srv, ss)
+	}
+	stream := &grpcmock.FakeServerStream{In: []interface{}{&thirdparty.Outer_Mid_Leaf{Value: "a"}}}
+	if err := mock_svc.InterceptRefs_Watch(interceptor, srv, stream); err != nil {
+		t.Fatal(err)
+	}
+	if info.FullMethod != "/xpkg.svc.Refs/Watch" || info.IsClientStream || !info.IsServerStream {
+		t.Errorf("interceptor ran with %+v, want a server stream of /xpkg.svc.Refs/Watch", info)
+	}
+	sent := stream.Sent()
+	if len(sent) != 1 || sent[0].(*svc.Local_A_B).GetLeaf().GetValue() != "a" {
+		t.Errorf("Sent() = %v, want the leaf a", sent)
+	}
+}
@@ -0,0 +1,76 @@
+package svc_test
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+
+	"example.com/gen/xpkg/common"
+	"example.com/gen/xpkg/svc"
+)
+
+// reporter is a gomock.TestReporter recording whether the controller failed
+// it. Fatalf stops the goroutine calling it, as testing.T.Fatalf does.
+type reporter struct {
+	failed bool
+}
+
+func (r *reporter) Errorf(string, ...interface{}) { r.failed = true }
+
+func (r *reporter) Fatalf(string, ...interface{}) {
+	r.failed = true
+	runtime.Goexit()
+}
+
+// logs returns a function such as t.Logf appending the lines logged with it
+// to lines.
+func logs(lines *[]string) func(format string, args ...interface{}) {
+	return func(format string, args ...interface{}) {
+		*lines = append(*lines, fmt.Sprintf(format, args...))
+	}
+}
+
+func TestLogCalls(t *testing.T) {
+	var lines []string
+	client := svc.NewMockRefsClient(gomock.NewController(t)).LogCalls(logs(&lines))
+	client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(&common.Ref{Kind: common.Kind_KIND_USER}, nil)
+	if _, err := client.Get(context.Background(), &common.Ref_Inner{Id: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "MockRefsClient.Get(") || !strings.Contains(lines[0], `id:"a"`) ||
+		!strings.HasPrefix(lines[1], "MockRefsClient.Get returned ") || !strings.Contains(lines[1], "KIND_USER") {
+		t.Errorf("logged %q, want the call to Get and its results", lines)
+	}
+}
+
+func TestLogCallsUnexpected(t *testing.T) {
+	var r reporter
+	var lines []string
+	client := svc.NewMockRefsClient(gomock.NewController(&r)).LogCalls(logs(&lines))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.Get(context.Background(), &common.Ref_Inner{Id: "a"})
+	}()
+	<-done
+	if !r.failed {
+		t.Error("the unexpected call did not fail the controller")
+	}
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "MockRefsClient.Get(") {
+		t.Errorf("logged %q, want the unexpected call to Get", lines)
+	}
+}
+
+func TestLogCallsOff(t *testing.T) {
+	var lines []string
+	client := svc.NewMockRefsClient(gomock.NewController(t)).LogCalls(logs(&lines)).LogCalls(nil)
+	client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, nil)
+	client.Get(context.Background(), &common.Ref_Inner{})
+	if len(lines) != 0 {
+		t.Errorf("logged %q after LogCalls(nil)", lines)
+	}
+}
@@ -0,0 +1,44 @@
+package svc_test
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"example.com/gen/xpkg/common"
+	"example.com/gen/xpkg/svc"
+)
+
+func TestFailsThenSucceeds(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	client := svc.NewMockRefsClient(gomock.NewController(t)).
+		GetFailsThenSucceeds(2, unavailable, &common.Ref{Kind: common.Kind_KIND_USER})
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := client.Get(ctx, &common.Ref_Inner{}); status.Code(err) != codes.Unavailable {
+			t.Fatalf("call %d: Get() = %v, want code Unavailable", i+1, err)
+		}
+	}
+	for _, opts := range [][]grpc.CallOption{nil, {grpc.WaitForReady(true)}} {
+		ref, err := client.Get(ctx, &common.Ref_Inner{}, opts...)
+		if err != nil || ref.GetKind() != common.Kind_KIND_USER {
+			t.Errorf("Get() with %d options after the failures = %v, %v, want KIND_USER", len(opts), ref, err)
+		}
+	}
+}
+
+func TestServerFailsThenSucceeds(t *testing.T) {
+	srv := svc.NewMockRefsServer(gomock.NewController(t)).
+		GetFailsThenSucceeds(1, status.Error(codes.Unavailable, "unavailable"), &common.Ref{})
+	ctx := context.Background()
+	if _, err := srv.Get(ctx, &common.Ref_Inner{}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Get() = %v, want code Unavailable", err)
+	}
+	if _, err := srv.Get(ctx, &common.Ref_Inner{}); err != nil {
+		t.Errorf("Get() after the failure = %v, want nil", err)
+	}
+}
@@ -0,0 +1,53 @@
+package svc_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gojuno/minimock/v3"
+
+	"example.com/gen/xpkg/common"
+	"example.com/gen/xpkg/svc"
+)
+
+func TestExpectReturn(t *testing.T) {
+	ctx := context.Background()
+	in := &common.Ref_Inner{Id: "a"}
+	client := svc.NewMockRefsClient(minimock.NewController(t))
+	client.GetMock.Expect(ctx, in).Return(&common.Ref{Inner: in}, nil)
+	ref, err := client.Get(ctx, in)
+	if err != nil || ref.GetInner().GetId() != "a" {
+		t.Errorf("Get() = %v, %v, want inner a", ref, err)
+	}
+	if got := client.GetAfterCounter(); got != 1 {
+		t.Errorf("GetAfterCounter() = %d, want 1", got)
+	}
+}
+
+func TestWhenThen(t *testing.T) {
+	ctx := context.Background()
+	a, b := &common.Ref_Inner{Id: "a"}, &common.Ref_Inner{Id: "b"}
+	srv := svc.NewMockRefsServer(t)
+	srv.GetMock.When(ctx, a).Then(&common.Ref{Kind: common.Kind_KIND_USER}, nil)
+	srv.GetMock.When(ctx, b).Then(&common.Ref{}, nil)
+	if ref, err := srv.Get(ctx, b); err != nil || ref.GetKind() != common.Kind_KIND_UNSPECIFIED {
+		t.Errorf("Get(b) = %v, %v, want KIND_UNSPECIFIED", ref, err)
+	}
+	if ref, err := srv.Get(ctx, a); err != nil || ref.GetKind() != common.Kind_KIND_USER {
+		t.Errorf("Get(a) = %v, %v, want KIND_USER", ref, err)
+	}
+}
+
+func TestSet(t *testing.T) {
+	srv := svc.NewMockRefsServer(t)
+	srv.GetMock.Set(func(_ context.Context, in *common.Ref_Inner) (*common.Ref, error) {
+		return &common.Ref{Inner: in}, nil
+	})
+	ref, err := srv.Get(context.Background(), &common.Ref_Inner{Id: "a"})
+	if err != nil || ref.GetInner().GetId() != "a" {
+		t.Errorf("Get() = %v, %v, want inner a", ref, err)
+	}
+	if !srv.MinimockGetDone() {
+		t.Error("MinimockGetDone() = false after the call")
+	}
+}
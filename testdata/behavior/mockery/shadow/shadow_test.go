@@ -0,0 +1,25 @@
+package shadow_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+
+	"example.com/gen/shadow"
+)
+
+// TestShadowedMethods checks that rpcs named like the methods of mock.Mock
+// are mocked without breaking the mock.
+func TestShadowedMethods(t *testing.T) {
+	client := shadow.NewMockShadowClient(t)
+	client.EXPECT().Called(mock.Anything, mock.Anything).Return(&shadow.Msg{Text: "called"}, nil)
+	client.EXPECT().AssertExpectations(mock.Anything, mock.Anything).Return(&shadow.Msg{Text: "asserted"}, nil)
+	ctx := context.Background()
+	if msg, err := client.Called(ctx, &shadow.Msg{}); err != nil || msg.GetText() != "called" {
+		t.Errorf("Called() = %v, %v, want called", msg, err)
+	}
+	if msg, err := client.AssertExpectations(ctx, &shadow.Msg{}); err != nil || msg.GetText() != "asserted" {
+		t.Errorf("AssertExpectations() = %v, %v, want asserted", msg, err)
+	}
+}
@@ -0,0 +1,55 @@
+package svc_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+
+	"example.com/gen/xpkg/common"
+	"example.com/gen/xpkg/svc"
+)
+
+func TestExpecterReturn(t *testing.T) {
+	client := svc.NewMockRefsClient(t)
+	client.EXPECT().Get(mock.Anything, mock.Anything).Return(&common.Ref{Kind: common.Kind_KIND_USER}, nil)
+	ref, err := client.Get(context.Background(), &common.Ref_Inner{Id: "a"})
+	if err != nil || ref.GetKind() != common.Kind_KIND_USER {
+		t.Errorf("Get() = %v, %v, want KIND_USER", ref, err)
+	}
+}
+
+func TestExpecterRunAndReturn(t *testing.T) {
+	srv := svc.NewMockRefsServer(t)
+	srv.EXPECT().Get(mock.Anything, mock.Anything).RunAndReturn(func(_ context.Context, in *common.Ref_Inner) (*common.Ref, error) {
+		return &common.Ref{Inner: in}, nil
+	})
+	ref, err := srv.Get(context.Background(), &common.Ref_Inner{Id: "a"})
+	if err != nil || ref.GetInner().GetId() != "a" {
+		t.Errorf("Get() = %v, %v, want inner a", ref, err)
+	}
+}
+
+// recorder is a t recording whether the mock failed it, and the cleanups it
+// registered.
+type recorder struct {
+	failed   bool
+	cleanups []func()
+}
+
+func (r *recorder) Logf(string, ...interface{})   {}
+func (r *recorder) Errorf(string, ...interface{}) { r.failed = true }
+func (r *recorder) FailNow()                      { r.failed = true }
+func (r *recorder) Cleanup(f func())              { r.cleanups = append(r.cleanups, f) }
+
+func TestUnmetExpectationFails(t *testing.T) {
+	var r recorder
+	client := svc.NewMockRefsClient(&r)
+	client.EXPECT().Get(mock.Anything, mock.Anything).Return(nil, nil)
+	for _, f := range r.cleanups {
+		f()
+	}
+	if !r.failed {
+		t.Error("the mock did not fail on an expected call that was not made")
+	}
+}
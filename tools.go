@@ -0,0 +1,12 @@
+//go:build tools
+
+package main
+
+// The tests build protoc-gen-go-grpc to compile the generated mocks with
+// the gRPC code they mock, and the generated mocks of the other frameworks
+// need their libraries.
+import (
+	_ "github.com/gojuno/minimock/v3"
+	_ "github.com/stretchr/testify/mock"
+	_ "google.golang.org/grpc/cmd/protoc-gen-go-grpc"
+)